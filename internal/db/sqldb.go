@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"gorm.io/driver/postgres"
@@ -11,10 +12,28 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-var db_ *gorm.DB
+var (
+	db_ *gorm.DB
+	mu  sync.Mutex
+)
 
 // Connect establishes a connection to the database
 func ConnectPG() {
+	if _, err := OpenPG(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+}
+
+// OpenPG connects to the database unless a connection is already open. A failed attempt is not
+// remembered, the next call tries again.
+func OpenPG() (*gorm.DB, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if db_ != nil {
+		return db_, nil
+	}
+
 	fmt.Println("Connecting to PostgreSQL")
 	dsn := os.Getenv("SUPABASE_DSN")
 
@@ -26,18 +45,22 @@ func ConnectPG() {
 		},
 	)
 
-	var err error
-	db_, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		PrepareStmt: false,
 		Logger:      newLogger,
 	})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return nil, err
 	}
 
+	db_ = conn
 	fmt.Println("Connected to PostgreSQL")
+	return db_, nil
 }
 
 func GetPGDB() *gorm.DB {
+	mu.Lock()
+	defer mu.Unlock()
+
 	return db_
 }
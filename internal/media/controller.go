@@ -2,14 +2,12 @@ package media
 
 // Import resty into your code and refer it as `resty`.
 import (
-	"bytes"
 	"fmt"
 	"log"
 
 	"github.com/creatorstation/toolbox/pkg/convert"
 	"github.com/creatorstation/toolbox/pkg/img"
 	"github.com/creatorstation/toolbox/pkg/video"
-	"github.com/creatorstation/toolbox/pkg/web"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -21,29 +19,16 @@ func MountController(router fiber.Router) {
 }
 
 func ConvertMP4ToMP3(c *fiber.Ctx) error {
-	var body MediaURLBody
-	if err := c.BodyParser(&body); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-
-	if err := body.Validate(); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-
-	log.Printf("Converting MP4 to MP3: %s", body.MediaURI)
-
-	mp4, err := web.FetchMedia(body.MediaURI)
+	in, err := resolveInput(c, "video/*", "audio/*")
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(inputStatus(err)).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	mp3, err := convert.ConvertMP4ToMP3(mp4)
+	log.Printf("Converting MP4 to MP3: %s", in.Source)
+
+	mp3, err := convert.ConvertMP4ToMP3(in.Body)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -55,27 +40,15 @@ func ConvertMP4ToMP3(c *fiber.Ctx) error {
 }
 
 func ResizeImage(c *fiber.Ctx) error {
-	file, err := c.FormFile("file")
+	in, err := resolveInput(c, "image/*")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		return c.Status(inputStatus(err)).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	fileContent, err := file.Open()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-
-	defer fileContent.Close()
-
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(fileContent)
-
-	isHEIF := file.Header.Get("Content-Type") == "image/heif" || file.Header.Get("Content-Type") == "image/heic"
-	jpegImage := convert.JPEG(buf.Bytes(), isHEIF)
+	isHEIF := in.SniffedType == "image/heic" || in.ContentType == "image/heif" || in.ContentType == "image/heic"
+	jpegImage := convert.JPEG(in.Body, isHEIF)
 
 	downscaleTo := 23.0
 
@@ -97,26 +70,14 @@ func ResizeImage(c *fiber.Ctx) error {
 }
 
 func ConvertQuicktimeToMP4(c *fiber.Ctx) error {
-	file, err := c.FormFile("file")
+	in, err := resolveInput(c, "video/*")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		return c.Status(inputStatus(err)).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	fileContent, err := file.Open()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-
-	defer fileContent.Close()
-
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(fileContent)
-
-	mp4, err := convert.ConvertQuicktimeToMP4(buf.Bytes())
+	mp4, err := convert.ConvertQuicktimeToMP4(in.Body)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -128,26 +89,14 @@ func ConvertQuicktimeToMP4(c *fiber.Ctx) error {
 }
 
 func GenerateThumbnail(c *fiber.Ctx) error {
-	file, err := c.FormFile("file")
+	in, err := resolveInput(c, "video/*")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		return c.Status(inputStatus(err)).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	fileContent, err := file.Open()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
-
-	defer fileContent.Close()
-
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(fileContent)
-
-	thumbnail, err := video.Thumbnail(buf.Bytes())
+	thumbnail, err := video.Thumbnail(in.Body)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
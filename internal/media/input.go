@@ -1,16 +1,161 @@
 package media
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/creatorstation/toolbox/pkg/web"
 	v "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	// errInvalidInput marks requests that do not carry usable media.
+	errInvalidInput = errors.New("invalid input")
+	// errDownload marks failures of the origin of a media_uri.
+	errDownload = errors.New("download failed")
 )
 
-type MediaURLBody struct {
+var (
+	httpURL = regexp.MustCompile(`^(?i)https?://`)
+	dataURL = regexp.MustCompile(`^data:([^;,]*)(;[^,]*)?,`)
+)
+
+// MediaInputBody is the JSON form of a media input, either a URL to download or base64 data.
+type MediaInputBody struct {
 	MediaURI string `json:"media_uri"`
+	// Data is plain base64 or a data URL, whose type is used when ContentType is empty.
+	Data        string `json:"data"`
+	ContentType string `json:"content_type"`
 }
 
-func (b MediaURLBody) Validate() error {
+func (b MediaInputBody) Validate() error {
 	return v.ValidateStruct(&b,
-		v.Field(&b.MediaURI, v.Required, is.URL),
+		v.Field(&b.MediaURI,
+			v.When(b.Data == "", v.Required.Error("media_uri or data is required")),
+			is.URL, v.Match(httpURL).Error("must be an http or https URL"),
+		),
+		v.Field(&b.Data, v.When(b.MediaURI != "", v.Empty.Error("only one of media_uri and data may be set"))),
 	)
 }
+
+// Input is the media of a request, whichever way it was sent.
+type Input struct {
+	*web.Media
+	// Source describes where the media came from, for logging.
+	Source string
+}
+
+// resolveInput reads the media of a request from a multipart "file" field, a JSON body with
+// media_uri or data, or else the raw body, and checks it against the accepted type patterns.
+func resolveInput(c *fiber.Ctx, accepted ...string) (*Input, error) {
+	in, err := readInput(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := in.Expect(accepted...); err != nil {
+		return nil, err
+	}
+
+	return in, nil
+}
+
+func readInput(c *fiber.Ctx) (*Input, error) {
+	contentType := string(c.Request().Header.ContentType())
+
+	switch {
+	case strings.HasPrefix(contentType, fiber.MIMEMultipartForm):
+		file, err := c.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidInput, err)
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("could not open upload: %w", err)
+		}
+		defer f.Close()
+
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not read upload: %w", err)
+		}
+
+		return &Input{Media: web.NewMedia(data, file.Header.Get("Content-Type")), Source: "upload " + file.Filename}, nil
+
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		var body MediaInputBody
+		if err := c.BodyParser(&body); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidInput, err)
+		}
+		if err := body.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidInput, err)
+		}
+
+		if body.MediaURI != "" {
+			media, err := web.FetchMedia(body.MediaURI)
+			if errors.Is(err, web.ErrFetcherConfig) {
+				return nil, err
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", errDownload, err)
+			}
+			return &Input{Media: media, Source: body.MediaURI}, nil
+		}
+
+		return decodeData(body)
+
+	default:
+		if len(c.Body()) == 0 {
+			return nil, fmt.Errorf("%w: send a multipart file, a JSON body with media_uri or data, or the media as the request body", errInvalidInput)
+		}
+		return &Input{Media: web.NewMedia(c.Body(), contentType), Source: "request body"}, nil
+	}
+}
+
+func decodeData(body MediaInputBody) (*Input, error) {
+	data, contentType := body.Data, body.ContentType
+
+	if m := dataURL.FindStringSubmatch(data); m != nil {
+		if !strings.Contains(m[2], ";base64") {
+			return nil, fmt.Errorf("%w: data URL has to be base64 encoded", errInvalidInput)
+		}
+		if contentType == "" {
+			contentType = m[1]
+		}
+		data = data[len(m[0]):]
+	}
+
+	// clients differ in whether they pad, wrap lines (as MIME does) and which alphabet they use
+	data = strings.TrimRight(strings.Join(strings.Fields(data), ""), "=")
+	decoded, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		if decoded, err = base64.RawURLEncoding.DecodeString(data); err != nil {
+			return nil, fmt.Errorf("%w: data is not valid base64", errInvalidInput)
+		}
+	}
+
+	return &Input{Media: web.NewMedia(decoded, contentType), Source: "base64 data"}, nil
+}
+
+// inputStatus maps a failure to resolve the media of a request to the status of the response.
+func inputStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidInput), errors.Is(err, web.ErrBlockedAddress):
+		return fiber.StatusBadRequest
+	case errors.Is(err, web.ErrTooLarge):
+		return fiber.StatusRequestEntityTooLarge
+	case errors.Is(err, web.ErrUnexpectedType):
+		return fiber.StatusUnprocessableEntity
+	case errors.Is(err, errDownload):
+		return fiber.StatusBadGateway
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
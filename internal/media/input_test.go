@@ -0,0 +1,179 @@
+package media
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/creatorstation/toolbox/pkg/web"
+	"github.com/gofiber/fiber/v2"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR test image")
+
+// inputApp answers with what resolveInput made of the request, or its error status.
+func inputApp() *fiber.App {
+	app := fiber.New()
+	app.Post("/", func(c *fiber.Ctx) error {
+		in, err := resolveInput(c, "image/*")
+		if err != nil {
+			return c.Status(inputStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"source": in.Source, "type": in.Type(), "body": in.Body})
+	})
+	return app
+}
+
+func multipartBody(t *testing.T, field, filename, contentType string, data []byte) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, field, filename))
+	header.Set("Content-Type", contentType)
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatalf("CreatePart: %v", err)
+	}
+	w.Write(data)
+	if err := mw.Close(); err != nil {
+		t.Fatalf("multipart: %v", err)
+	}
+	return &buf, mw.FormDataContentType()
+}
+
+func jsonBody(t *testing.T, body MediaInputBody) io.Reader {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return bytes.NewReader(data)
+}
+
+func TestResolveInput(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(testPNG)
+		case "/large.png":
+			w.Write(bytes.Repeat(testPNG, 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer origin.Close()
+
+	// FetchMedia reads its configuration once, the test server is on a loopback address
+	t.Setenv("MEDIA_FETCH_ALLOW", "127.0.0.0/8")
+	t.Setenv("MEDIA_FETCH_MAX_BYTES", "1024")
+	t.Setenv("MEDIA_CACHE_MAX_BYTES", "0")
+
+	encoded := base64.StdEncoding.EncodeToString(testPNG)
+	// MIME wraps base64 at 76 characters, URL-safe encoders drop the padding
+	wrapped := encoded[:20] + "\r\n" + encoded[20:]
+	// the leading bytes encode to - and _, the body is then typed by its declared content type
+	unsniffed := append([]byte{0xfb, 0xff}, testPNG...)
+	urlSafe := base64.RawURLEncoding.EncodeToString(unsniffed)
+
+	upload, uploadType := multipartBody(t, "file", "avatar.png", "image/png", testPNG)
+	wrongField, wrongFieldType := multipartBody(t, "image", "avatar.png", "image/png", testPNG)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        io.Reader
+		status      int
+		source      string
+		data        []byte
+	}{
+		{"multipart upload", uploadType, upload, fiber.StatusOK, "upload avatar.png", testPNG},
+		{"multipart without file", wrongFieldType, wrongField, fiber.StatusBadRequest, "", nil},
+		{"raw body", "image/png", bytes.NewReader(testPNG), fiber.StatusOK, "request body", testPNG},
+		{"empty raw body", "", nil, fiber.StatusBadRequest, "", nil},
+		{"media_uri", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{MediaURI: origin.URL + "/image.png"}), fiber.StatusOK, origin.URL + "/image.png", testPNG},
+		{"plain base64", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{Data: encoded}), fiber.StatusOK, "base64 data", testPNG},
+		{"wrapped base64", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{Data: wrapped}), fiber.StatusOK, "base64 data", testPNG},
+		{"data URL", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{Data: "data:image/png;base64," + encoded}), fiber.StatusOK, "base64 data", testPNG},
+		{"URL-safe base64", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{Data: urlSafe, ContentType: "image/png"}), fiber.StatusOK, "base64 data", unsniffed},
+		{"data URL without base64", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{Data: "data:image/png,abc"}), fiber.StatusBadRequest, "", nil},
+		{"invalid base64", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{Data: "not base64!"}), fiber.StatusBadRequest, "", nil},
+		{"both media_uri and data", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{MediaURI: origin.URL, Data: encoded}), fiber.StatusBadRequest, "", nil},
+		{"neither media_uri nor data", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{}), fiber.StatusBadRequest, "", nil},
+		{"malformed JSON", fiber.MIMEApplicationJSON, strings.NewReader("{"), fiber.StatusBadRequest, "", nil},
+		{"unexpected type", "text/plain", strings.NewReader("just text"), fiber.StatusUnprocessableEntity, "", nil},
+		{"too large download", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{MediaURI: origin.URL + "/large.png"}), fiber.StatusRequestEntityTooLarge, "", nil},
+		{"failed download", fiber.MIMEApplicationJSON, jsonBody(t, MediaInputBody{MediaURI: origin.URL + "/missing.png"}), fiber.StatusBadGateway, "", nil},
+	}
+
+	app := inputApp()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, "/", tt.body)
+			if tt.contentType != "" {
+				req.Header.Set(fiber.HeaderContentType, tt.contentType)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var got struct {
+				Source string `json:"source"`
+				Type   string `json:"type"`
+				Body   []byte `json:"body"`
+				Error  string `json:"error"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d (%s), want %d", resp.StatusCode, got.Error, tt.status)
+			}
+			if tt.status != fiber.StatusOK {
+				return
+			}
+			if got.Source != tt.source || got.Type != "image/png" {
+				t.Errorf("got %s from %q, want image/png from %q", got.Type, got.Source, tt.source)
+			}
+			if tt.data != nil && !bytes.Equal(got.Body, tt.data) {
+				t.Errorf("body = %q, want %q", got.Body, tt.data)
+			}
+		})
+	}
+}
+
+func TestInputStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w: no file", errInvalidInput), fiber.StatusBadRequest},
+		{fmt.Errorf("fetch: %w", web.ErrBlockedAddress), fiber.StatusBadRequest},
+		{fmt.Errorf("fetch: %w", web.ErrTooLarge), fiber.StatusRequestEntityTooLarge},
+		{fmt.Errorf("%w: expected image/*", web.ErrUnexpectedType), fiber.StatusUnprocessableEntity},
+		{fmt.Errorf("%w: 404 Not Found", errDownload), fiber.StatusBadGateway},
+		{fmt.Errorf("%w: bad timeout", web.ErrFetcherConfig), fiber.StatusInternalServerError},
+		{errors.New("could not read upload"), fiber.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if got := inputStatus(tt.err); got != tt.want {
+			t.Errorf("inputStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
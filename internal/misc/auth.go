@@ -0,0 +1,152 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// ErrAGIAuth is returned when AGI rejects the credentials even after a token refresh.
+var ErrAGIAuth = errors.New("AGI authentication failed")
+
+// tokenExpirySkew renews tokens this long before they expire so a capture doesn't start with a
+// token that runs out halfway through.
+const tokenExpirySkew = time.Minute
+
+// agiTokenResponse is the body returned by the AGI login and refresh endpoints.
+type agiTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// AGIAuth provides the Authorization header for AGI pages. It is configured by:
+//
+//	AGI_TOKEN          static header value, used as is until it is rejected
+//	AGI_LOGIN_URL      endpoint receiving {"email", "password"} from AGI_EMAIL and AGI_PASSWORD
+//	AGI_REFRESH_URL    endpoint receiving {"refresh_token"}, seeded by AGI_REFRESH_TOKEN
+//
+// Both endpoints answer with {"access_token", "refresh_token", "token_type", "expires_in"}.
+type AGIAuth struct {
+	loginURL     string
+	refreshURL   string
+	email        string
+	password     string
+	client       *resty.Client
+	mu           sync.Mutex
+	header       string
+	refreshToken string
+	expiresAt    time.Time
+}
+
+var (
+	agiAuth     *AGIAuth
+	agiAuthOnce sync.Once
+)
+
+func getAGIAuth() *AGIAuth {
+	agiAuthOnce.Do(func() {
+		agiAuth = &AGIAuth{
+			loginURL:     os.Getenv("AGI_LOGIN_URL"),
+			refreshURL:   os.Getenv("AGI_REFRESH_URL"),
+			email:        os.Getenv("AGI_EMAIL"),
+			password:     os.Getenv("AGI_PASSWORD"),
+			client:       resty.New().SetTimeout(30 * time.Second),
+			header:       os.Getenv("AGI_TOKEN"),
+			refreshToken: os.Getenv("AGI_REFRESH_TOKEN"),
+		}
+	})
+	return agiAuth
+}
+
+// Header returns the current Authorization header value, logging in or refreshing when there is
+// no valid token.
+func (a *AGIAuth) Header() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.header != "" && (a.expiresAt.IsZero() || time.Until(a.expiresAt) > tokenExpirySkew) {
+		return a.header, nil
+	}
+
+	if err := a.renew(); err != nil {
+		return "", err
+	}
+	return a.header, nil
+}
+
+// Invalidate drops a header that AGI rejected and reports whether a new one can be obtained.
+// Callers that saw the same rejection concurrently only cause one renewal, since a header that
+// was already replaced is left alone. A static AGI_TOKEN without credentials to renew it is kept,
+// so a single rejection does not fail every later capture before the token is even tried.
+func (a *AGIAuth) Invalidate(header string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.canRenew() {
+		return false
+	}
+	if a.header == header {
+		a.header = ""
+	}
+	return true
+}
+
+func (a *AGIAuth) canRenew() bool {
+	return a.refreshURL != "" && a.refreshToken != "" || a.loginURL != "" && a.email != ""
+}
+
+// renew refreshes the token when a refresh token is known and falls back to logging in.
+func (a *AGIAuth) renew() error {
+	if a.refreshURL != "" && a.refreshToken != "" {
+		err := a.requestToken(a.refreshURL, map[string]string{"refresh_token": a.refreshToken})
+		if err == nil {
+			return nil
+		}
+		log.Printf("AGI token refresh failed, logging in again: %v", err)
+	}
+
+	if a.loginURL != "" && a.email != "" {
+		return a.requestToken(a.loginURL, map[string]string{"email": a.email, "password": a.password})
+	}
+
+	return fmt.Errorf("%w: no valid token and no AGI credentials are configured", ErrAGIAuth)
+}
+
+func (a *AGIAuth) requestToken(endpoint string, body map[string]string) error {
+	var token agiTokenResponse
+	res, err := a.client.R().SetBody(body).SetResult(&token).ForceContentType("application/json").Post(endpoint)
+	if err != nil {
+		return fmt.Errorf("could not request AGI token: %w", err)
+	}
+	if res.IsError() {
+		return fmt.Errorf("%w: %s returned %s", ErrAGIAuth, endpoint, res.Status())
+	}
+	if token.AccessToken == "" {
+		return fmt.Errorf("%w: %s returned no access token", ErrAGIAuth, endpoint)
+	}
+
+	tokenType := token.TokenType
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+
+	a.header = tokenType + " " + strings.TrimSpace(token.AccessToken)
+	if token.RefreshToken != "" {
+		a.refreshToken = token.RefreshToken
+	}
+	a.expiresAt = time.Time{}
+	if token.ExpiresIn > 0 {
+		a.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	log.Printf("Obtained AGI token from %s", endpoint)
+	return nil
+}
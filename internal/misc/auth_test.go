@@ -0,0 +1,33 @@
+package misc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAGIAuthKeepsStaticToken(t *testing.T) {
+	auth := &AGIAuth{header: "Bearer static"}
+
+	if auth.Invalidate("Bearer static") {
+		t.Errorf("Invalidate reported a static token as renewable")
+	}
+	if header, err := auth.Header(); err != nil || header != "Bearer static" {
+		t.Errorf("Header after a rejection = %q, %v", header, err)
+	}
+}
+
+func TestAGIAuthInvalidatesRenewableToken(t *testing.T) {
+	auth := &AGIAuth{header: "Bearer old", loginURL: "http://127.0.0.1:0/login", email: "bot@example.com"}
+
+	if !auth.Invalidate("Bearer new") || auth.header != "Bearer old" {
+		t.Errorf("Invalidate dropped a header that was already replaced")
+	}
+	if !auth.Invalidate("Bearer old") || auth.header != "" {
+		t.Errorf("Invalidate kept a rejected renewable header")
+	}
+
+	auth.loginURL = ""
+	if _, err := auth.Header(); !errors.Is(err, ErrAGIAuth) {
+		t.Errorf("Header without credentials error = %v, want ErrAGIAuth", err)
+	}
+}
@@ -0,0 +1,374 @@
+package misc
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creatorstation/toolbox/pkg/web"
+)
+
+// cacheFileTypes maps the extensions of cache files to the content types they hold.
+var cacheFileTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+	".bin":  "application/octet-stream",
+}
+
+// FileCache keeps screenshots as files named by key and content type in a directory with an in-memory index that is
+// rebuilt from the directory on startup, so entries survive restarts. Keys are path escaped in file
+// names, so a key never points outside the directory. Previous versions are hard links in the
+// versions subdirectory and are not indexed.
+type FileCache struct {
+	cache     map[string]CacheItem
+	cachePath string
+	mu        sync.RWMutex
+}
+
+// CacheItem represents a single cached screenshot
+type CacheItem struct {
+	filePath    string
+	contentType string
+	timestamp   time.Time
+	lastAccess  time.Time
+	size        int64
+}
+
+// NewFileCache creates the cache directory if needed and indexes the files already in it.
+func NewFileCache(dir string) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c := &FileCache{
+		cache:     make(map[string]CacheItem),
+		cachePath: dir,
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		contentType, known := cacheFileTypes[ext]
+		if e.IsDir() || !known {
+			continue
+		}
+
+		key, err := url.PathUnescape(strings.TrimSuffix(e.Name(), ext))
+		if err != nil {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		c.cache[key] = CacheItem{
+			filePath:    filepath.Join(dir, e.Name()),
+			contentType: contentType,
+			timestamp:   info.ModTime(),
+			lastAccess:  info.ModTime(),
+			size:        info.Size(),
+		}
+	}
+
+	log.Printf("Screenshot cache indexed %d files from %s", len(c.cache), dir)
+	return c, nil
+}
+
+func (c *FileCache) Get(key string) (*CacheEntry, bool, error) {
+	c.mu.RLock()
+	item, exists := c.cache[key]
+	c.mu.RUnlock()
+
+	if !exists {
+		return nil, false, nil
+	}
+
+	data, err := os.ReadFile(item.filePath)
+	if os.IsNotExist(err) {
+		c.mu.Lock()
+		delete(c.cache, key)
+		c.mu.Unlock()
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	if item, ok := c.cache[key]; ok {
+		item.lastAccess = time.Now()
+		c.cache[key] = item
+	}
+	c.mu.Unlock()
+
+	return &CacheEntry{Data: data, StoredAt: item.timestamp, ContentType: item.contentType}, true, nil
+}
+
+func (c *FileCache) Set(key string, data []byte) error {
+	contentType := cacheContentType(data)
+	path := filepath.Join(c.cachePath, url.PathEscape(key)+cacheFileExt(contentType))
+	// replacing the file instead of writing into it leaves versions linked to the old one intact
+	if err := web.WriteFileAtomic(path, data); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	previous, existed := c.cache[key]
+	c.cache[key] = CacheItem{
+		filePath:    path,
+		contentType: contentType,
+		timestamp:   now,
+		lastAccess:  now,
+		size:        int64(len(data)),
+	}
+	c.mu.Unlock()
+
+	// an entry that changed its type leaves a file with the old extension behind
+	if existed && previous.filePath != path {
+		return removeCacheFile(previous.filePath)
+	}
+
+	return nil
+}
+
+func (c *FileCache) Delete(key string) error {
+	c.mu.Lock()
+	item, exists := c.cache[key]
+	delete(c.cache, key)
+	c.mu.Unlock()
+
+	if !exists {
+		return nil
+	}
+
+	return removeCacheFile(item.filePath)
+}
+
+func (c *FileCache) Purge(maxAge time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, item := range c.cache {
+		if now.Sub(item.timestamp) > maxAge {
+			if err := removeCacheFile(item.filePath); err != nil {
+				log.Printf("Failed to remove expired cache file: %v", err)
+			}
+			delete(c.cache, key)
+		}
+	}
+
+	versions, err := os.ReadDir(c.versionsPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, v := range versions {
+		_, storedAt, ok := c.parseVersionFile(v.Name())
+		if ok && now.Sub(storedAt) > versionRetention {
+			if err := removeCacheFile(filepath.Join(c.versionsPath(), v.Name())); err != nil {
+				log.Printf("Failed to remove expired screenshot version: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *FileCache) DeletePrefix(prefix string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key, item := range c.cache {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if err := removeCacheFile(item.filePath); err != nil {
+			return removed, err
+		}
+		delete(c.cache, key)
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (c *FileCache) Keys(prefix string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var keys []string
+	for key := range c.cache {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (c *FileCache) Stats() (CacheStats, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := CacheStats{Entries: len(c.cache)}
+	for key, item := range c.cache {
+		stats.TotalBytes += item.size
+		if stats.OldestKey == "" || item.timestamp.Before(stats.OldestStoredAt) {
+			stats.OldestKey = key
+			stats.OldestStoredAt = item.timestamp
+		}
+	}
+
+	return stats, nil
+}
+
+func (c *FileCache) Evict(maxBytes int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var total int64
+	keys := make([]string, 0, len(c.cache))
+	for key, item := range c.cache {
+		total += item.size
+		keys = append(keys, key)
+	}
+
+	if total <= maxBytes {
+		return nil
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return c.cache[keys[i]].lastAccess.Before(c.cache[keys[j]].lastAccess)
+	})
+
+	for _, key := range keys {
+		if total <= maxBytes {
+			break
+		}
+		item := c.cache[key]
+		if err := removeCacheFile(item.filePath); err != nil {
+			return err
+		}
+		delete(c.cache, key)
+		total -= item.size
+	}
+
+	return nil
+}
+
+func (c *FileCache) Archive(key string) error {
+	c.mu.RLock()
+	item, exists := c.cache[key]
+	c.mu.RUnlock()
+
+	if !exists || item.contentType != "image/png" {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.versionsPath(), 0755); err != nil {
+		return fmt.Errorf("failed to create versions directory: %w", err)
+	}
+
+	target := c.versionPath(key, item.timestamp)
+	err := os.Link(item.filePath, target)
+	if err == nil || os.IsExist(err) || os.IsNotExist(err) {
+		return nil
+	}
+
+	// file systems without hard links get a copy
+	data, err := os.ReadFile(item.filePath)
+	if err != nil {
+		return err
+	}
+	return web.WriteFileAtomic(target, data)
+}
+
+func (c *FileCache) Versions(key string) ([]time.Time, error) {
+	files, err := os.ReadDir(c.versionsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var times []time.Time
+	for _, f := range files {
+		if base, storedAt, ok := c.parseVersionFile(f.Name()); ok && base == key {
+			times = append(times, storedAt)
+		}
+	}
+
+	return times, nil
+}
+
+func (c *FileCache) GetVersion(key string, storedAt time.Time) (*CacheEntry, bool, error) {
+	data, err := os.ReadFile(c.versionPath(key, storedAt))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &CacheEntry{Data: data, StoredAt: storedAt, ContentType: "image/png"}, true, nil
+}
+
+func (c *FileCache) DeleteVersion(key string, storedAt time.Time) error {
+	return removeCacheFile(c.versionPath(key, storedAt))
+}
+
+func (c *FileCache) versionsPath() string {
+	return filepath.Join(c.cachePath, "versions")
+}
+
+// versionPath names a version file. Only PNG captures are versioned.
+func (c *FileCache) versionPath(key string, storedAt time.Time) string {
+	return filepath.Join(c.versionsPath(), versionKey(url.PathEscape(key), storedAt)+".png")
+}
+
+func (c *FileCache) parseVersionFile(name string) (string, time.Time, bool) {
+	escaped, id, ok := parseVersionKey(strings.TrimSuffix(name, ".png"))
+	if !ok {
+		return "", time.Time{}, false
+	}
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	nanos, _ := strconv.ParseInt(id, 10, 64)
+	return key, time.Unix(0, nanos), true
+}
+
+func cacheFileExt(contentType string) string {
+	for ext, t := range cacheFileTypes {
+		if t == contentType {
+			return ext
+		}
+	}
+	return ".bin"
+}
+
+func removeCacheFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
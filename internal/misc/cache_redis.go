@@ -0,0 +1,339 @@
+package misc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix = "screenshot:"
+	// redisIndexKey is a sorted set of every cached key scored by its last access
+	redisIndexKey = "screenshot-index"
+
+	redisVersionPrefix = "screenshot-version:"
+	// redisVersionIndexKey is a sorted set of every version name, all scored 0 so it can be
+	// queried by lexical range
+	redisVersionIndexKey = "screenshot-versions"
+)
+
+// RedisCache stores screenshots in Redis (or anything speaking its protocol) as hashes holding the
+// image, its content type, size and timestamp. Expiry is mostly left to Redis TTLs; a sorted set indexes the keys by
+// last access for prefix deletion, stats and LRU eviction. Versions are copies of the hashes under
+// their own prefix and index.
+type RedisCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisCache connects to a redis:// URL.
+func NewRedisCache(redisURL string, ttl time.Duration) (*RedisCache, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("could not connect to redis: %w", err)
+	}
+
+	return &RedisCache{client: client, ttl: ttl}, nil
+}
+
+func (c *RedisCache) Get(key string) (*CacheEntry, bool, error) {
+	ctx := context.Background()
+
+	values, err := c.client.HMGet(ctx, redisKeyPrefix+key, "data", "ts", "type").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, ok := values[0].(string)
+	if !ok {
+		return nil, false, nil
+	}
+
+	ts, _ := values[1].(string)
+	unix, _ := strconv.ParseInt(ts, 10, 64)
+	contentType, _ := values[2].(string)
+
+	c.client.ZAdd(ctx, redisIndexKey, redis.Z{Score: float64(time.Now().UnixNano()), Member: key})
+
+	return &CacheEntry{Data: []byte(data), StoredAt: time.Unix(0, unix), ContentType: contentType}, true, nil
+}
+
+func (c *RedisCache) Set(key string, data []byte) error {
+	ctx := context.Background()
+	now := time.Now().UnixNano()
+
+	pipe := c.client.TxPipeline()
+	pipe.HSet(ctx, redisKeyPrefix+key, "data", data, "size", len(data), "ts", strconv.FormatInt(now, 10), "type", cacheContentType(data))
+	pipe.Expire(ctx, redisKeyPrefix+key, c.ttl)
+	pipe.ZAdd(ctx, redisIndexKey, redis.Z{Score: float64(now), Member: key})
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (c *RedisCache) Delete(key string) error {
+	ctx := context.Background()
+
+	pipe := c.client.TxPipeline()
+	pipe.Del(ctx, redisKeyPrefix+key)
+	pipe.ZRem(ctx, redisIndexKey, key)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Purge removes entries stored more than maxAge ago, which their TTL has not caught yet when
+// maxAge is shorter than it. Listing the entries also drops index members that already expired.
+func (c *RedisCache) Purge(maxAge time.Duration) error {
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if now.Sub(e.storedAt) > maxAge {
+			if err := c.Delete(e.key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *RedisCache) DeletePrefix(prefix string) (int, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, e := range entries {
+		if !strings.HasPrefix(e.key, prefix) {
+			continue
+		}
+		if err := c.Delete(e.key); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (c *RedisCache) Keys(prefix string) ([]string, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.key, prefix) {
+			keys = append(keys, e.key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (c *RedisCache) Stats() (CacheStats, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return CacheStats{}, err
+	}
+
+	stats := CacheStats{Entries: len(entries)}
+	for _, e := range entries {
+		stats.TotalBytes += e.size
+		if stats.OldestKey == "" || e.storedAt.Before(stats.OldestStoredAt) {
+			stats.OldestKey = e.key
+			stats.OldestStoredAt = e.storedAt
+		}
+	}
+
+	return stats, nil
+}
+
+func (c *RedisCache) Evict(maxBytes int64) error {
+	// entries come back least recently used first
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+
+	for _, e := range entries {
+		if total <= maxBytes {
+			break
+		}
+		if err := c.Delete(e.key); err != nil {
+			return err
+		}
+		total -= e.size
+	}
+
+	return nil
+}
+
+// Archive copies the hash on the server, without reading the image or touching the access index.
+func (c *RedisCache) Archive(key string) error {
+	ctx := context.Background()
+
+	values, err := c.client.HMGet(ctx, redisKeyPrefix+key, "ts", "type").Result()
+	if err != nil {
+		return err
+	}
+
+	ts, ok := values[0].(string)
+	if !ok || values[1] != "image/png" {
+		return nil
+	}
+
+	unix, _ := strconv.ParseInt(ts, 10, 64)
+	name := versionKey(key, time.Unix(0, unix))
+
+	pipe := c.client.TxPipeline()
+	pipe.Copy(ctx, redisKeyPrefix+key, redisVersionPrefix+name, 0, true)
+	pipe.Expire(ctx, redisVersionPrefix+name, versionRetention)
+	pipe.ZAdd(ctx, redisVersionIndexKey, redis.Z{Member: name})
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// Versions drops index members whose hash expired on the way.
+func (c *RedisCache) Versions(key string) ([]time.Time, error) {
+	ctx := context.Background()
+
+	prefix := key + versionSeparator
+	names, err := c.client.ZRangeByLex(ctx, redisVersionIndexKey, &redis.ZRangeBy{
+		Min: "[" + prefix,
+		Max: "[" + prefix + "\xff",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(names))
+	for i, name := range names {
+		cmds[i] = pipe.Exists(ctx, redisVersionPrefix+name)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	var times []time.Time
+	var expired []interface{}
+	for i, cmd := range cmds {
+		if cmd.Val() == 0 {
+			expired = append(expired, names[i])
+			continue
+		}
+		base, id, ok := parseVersionKey(names[i])
+		if !ok || base != key {
+			continue
+		}
+		nanos, _ := strconv.ParseInt(id, 10, 64)
+		times = append(times, time.Unix(0, nanos))
+	}
+
+	if len(expired) > 0 {
+		c.client.ZRem(ctx, redisVersionIndexKey, expired...)
+	}
+
+	return times, nil
+}
+
+func (c *RedisCache) GetVersion(key string, storedAt time.Time) (*CacheEntry, bool, error) {
+	values, err := c.client.HMGet(context.Background(), redisVersionPrefix+versionKey(key, storedAt), "data", "type").Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, ok := values[0].(string)
+	if !ok {
+		return nil, false, nil
+	}
+	contentType, _ := values[1].(string)
+
+	return &CacheEntry{Data: []byte(data), StoredAt: storedAt, ContentType: contentType}, true, nil
+}
+
+func (c *RedisCache) DeleteVersion(key string, storedAt time.Time) error {
+	ctx := context.Background()
+	name := versionKey(key, storedAt)
+
+	pipe := c.client.TxPipeline()
+	pipe.Del(ctx, redisVersionPrefix+name)
+	pipe.ZRem(ctx, redisVersionIndexKey, name)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+type redisEntry struct {
+	key      string
+	size     int64
+	storedAt time.Time
+}
+
+// entries lists the indexed entries by last access, dropping index members whose hash expired.
+func (c *RedisCache) entries() ([]redisEntry, error) {
+	ctx := context.Background()
+
+	keys, err := c.client.ZRange(ctx, redisIndexKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HMGet(ctx, redisKeyPrefix+key, "size", "ts")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	var entries []redisEntry
+	var expired []interface{}
+	for i, cmd := range cmds {
+		values := cmd.Val()
+		size, ok := values[0].(string)
+		if !ok {
+			expired = append(expired, keys[i])
+			continue
+		}
+
+		ts, _ := values[1].(string)
+		n, _ := strconv.ParseInt(size, 10, 64)
+		unix, _ := strconv.ParseInt(ts, 10, 64)
+		entries = append(entries, redisEntry{key: keys[i], size: n, storedAt: time.Unix(0, unix)})
+	}
+
+	if len(expired) > 0 {
+		c.client.ZRem(ctx, redisIndexKey, expired...)
+	}
+
+	return entries, nil
+}
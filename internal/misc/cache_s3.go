@@ -0,0 +1,294 @@
+package misc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3CacheOptions configures an S3-compatible cache backend (AWS S3, MinIO, R2, ...).
+type S3CacheOptions struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Prefix    string
+	UseSSL    bool
+}
+
+// s3VersionsDir holds the versions below the prefix, apart from the entries.
+const s3VersionsDir = "~versions/"
+
+// S3Cache stores screenshots as objects named by key with their sniffed content type; an object's
+// last modification time is its timestamp.
+type S3Cache struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Cache connects to the endpoint and creates the bucket if it does not exist.
+func NewS3Cache(opts S3CacheOptions) (*S3Cache, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required")
+	}
+
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create s3 client: %w", err)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach bucket %s: %w", opts.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, opts.Bucket, minio.MakeBucketOptions{}); err != nil {
+			return nil, fmt.Errorf("could not create bucket %s: %w", opts.Bucket, err)
+		}
+	}
+
+	return &S3Cache{client: client, bucket: opts.Bucket, prefix: opts.Prefix}, nil
+}
+
+func (c *S3Cache) Get(key string) (*CacheEntry, bool, error) {
+	obj, err := c.client.GetObject(context.Background(), c.bucket, c.objectName(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, false, err
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &CacheEntry{Data: data, StoredAt: info.LastModified, ContentType: info.ContentType}, true, nil
+}
+
+func (c *S3Cache) Set(key string, data []byte) error {
+	_, err := c.client.PutObject(context.Background(), c.bucket, c.objectName(key), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: cacheContentType(data),
+	})
+	return err
+}
+
+func (c *S3Cache) Delete(key string) error {
+	return c.client.RemoveObject(context.Background(), c.bucket, c.objectName(key), minio.RemoveObjectOptions{})
+}
+
+func (c *S3Cache) Purge(maxAge time.Duration) error {
+	objects, err := c.list(c.prefix)
+	if err != nil {
+		return err
+	}
+
+	versions, err := c.listVersions("")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, obj := range objects {
+		if now.Sub(obj.LastModified) <= maxAge {
+			continue
+		}
+		if err := c.client.RemoveObject(context.Background(), c.bucket, obj.Key, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+
+	for _, obj := range versions {
+		if _, storedAt, ok := c.parseVersionObject(obj.Key); ok && now.Sub(storedAt) <= versionRetention {
+			continue
+		}
+		if err := c.client.RemoveObject(context.Background(), c.bucket, obj.Key, minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *S3Cache) DeletePrefix(prefix string) (int, error) {
+	objects, err := c.list(c.prefix + prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, obj := range objects {
+		if err := c.client.RemoveObject(context.Background(), c.bucket, obj.Key, minio.RemoveObjectOptions{}); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (c *S3Cache) Keys(prefix string) ([]string, error) {
+	objects, err := c.list(c.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, c.keyOf(obj.Key))
+	}
+
+	return keys, nil
+}
+
+func (c *S3Cache) Stats() (CacheStats, error) {
+	objects, err := c.list(c.prefix)
+	if err != nil {
+		return CacheStats{}, err
+	}
+
+	stats := CacheStats{Entries: len(objects)}
+	for _, obj := range objects {
+		stats.TotalBytes += obj.Size
+		if stats.OldestKey == "" || obj.LastModified.Before(stats.OldestStoredAt) {
+			stats.OldestKey = c.keyOf(obj.Key)
+			stats.OldestStoredAt = obj.LastModified
+		}
+	}
+
+	return stats, nil
+}
+
+// Evict is not supported, S3 keeps no access times to evict the least recently used objects by.
+// Bucket lifecycle rules bound the size instead.
+func (c *S3Cache) Evict(maxBytes int64) error {
+	return errEvictUnsupported
+}
+
+// Archive copies the object on the server, which neither reads the image nor counts as an access.
+func (c *S3Cache) Archive(key string) error {
+	ctx := context.Background()
+
+	info, err := c.client.StatObject(ctx, c.bucket, c.objectName(key), minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ContentType != "image/png" {
+		return nil
+	}
+
+	_, err = c.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: c.bucket, Object: c.versionName(key, info.LastModified)},
+		minio.CopySrcOptions{Bucket: c.bucket, Object: c.objectName(key)},
+	)
+	return err
+}
+
+func (c *S3Cache) Versions(key string) ([]time.Time, error) {
+	objects, err := c.listVersions(key + versionSeparator)
+	if err != nil {
+		return nil, err
+	}
+
+	var times []time.Time
+	for _, obj := range objects {
+		if base, storedAt, ok := c.parseVersionObject(obj.Key); ok && base == key {
+			times = append(times, storedAt)
+		}
+	}
+
+	return times, nil
+}
+
+func (c *S3Cache) GetVersion(key string, storedAt time.Time) (*CacheEntry, bool, error) {
+	obj, err := c.client.GetObject(context.Background(), c.bucket, c.versionName(key, storedAt), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, false, err
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &CacheEntry{Data: data, StoredAt: storedAt, ContentType: "image/png"}, true, nil
+}
+
+func (c *S3Cache) DeleteVersion(key string, storedAt time.Time) error {
+	return c.client.RemoveObject(context.Background(), c.bucket, c.versionName(key, storedAt), minio.RemoveObjectOptions{})
+}
+
+// list returns every cached object below prefix, leaving out the versions.
+func (c *S3Cache) list(prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for obj := range c.client.ListObjects(context.Background(), c.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if !strings.HasPrefix(obj.Key, c.prefix+s3VersionsDir) {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// listVersions returns the version objects whose name starts with prefix.
+func (c *S3Cache) listVersions(prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for obj := range c.client.ListObjects(context.Background(), c.bucket, minio.ListObjectsOptions{Prefix: c.prefix + s3VersionsDir + prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// versionName names a version object. Only PNG captures are versioned.
+func (c *S3Cache) versionName(key string, storedAt time.Time) string {
+	return c.prefix + s3VersionsDir + versionKey(key, storedAt) + ".png"
+}
+
+func (c *S3Cache) parseVersionObject(objectName string) (string, time.Time, bool) {
+	name := strings.TrimSuffix(strings.TrimPrefix(objectName, c.prefix+s3VersionsDir), ".png")
+	key, id, ok := parseVersionKey(name)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	nanos, _ := strconv.ParseInt(id, 10, 64)
+	return key, time.Unix(0, nanos), true
+}
+
+func (c *S3Cache) keyOf(objectName string) string {
+	return strings.TrimPrefix(objectName, c.prefix)
+}
+
+func (c *S3Cache) objectName(key string) string {
+	return c.prefix + key
+}
@@ -0,0 +1,325 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+var (
+	testPNG = []byte("\x89PNG\r\n\x1a\n-first-")
+	testPDF = []byte("%PDF-1.4 document")
+)
+
+// cacheBackend is a Cache implementation under test. tick is the pause between writes that gives
+// them distinct timestamps, lru is whether the backend supports Evict.
+type cacheBackend struct {
+	name string
+	new  func(t *testing.T) Cache
+	tick time.Duration
+	lru  bool
+}
+
+// cacheBackends returns the backends available here: the file system and miniredis always, and
+// MinIO or another S3 endpoint when S3_TEST_ENDPOINT is set.
+func cacheBackends() []cacheBackend {
+	backends := []cacheBackend{
+		{
+			name: "fs",
+			new: func(t *testing.T) Cache {
+				c, err := NewFileCache(t.TempDir())
+				if err != nil {
+					t.Fatalf("NewFileCache: %v", err)
+				}
+				return c
+			},
+			tick: 10 * time.Millisecond,
+			lru:  true,
+		},
+		{
+			name: "redis",
+			new: func(t *testing.T) Cache {
+				server := miniredis.RunT(t)
+				c, err := NewRedisCache("redis://"+server.Addr(), time.Hour)
+				if err != nil {
+					t.Fatalf("NewRedisCache: %v", err)
+				}
+				return c
+			},
+			tick: 10 * time.Millisecond,
+			lru:  true,
+		},
+	}
+
+	if endpoint := os.Getenv("S3_TEST_ENDPOINT"); endpoint != "" {
+		backends = append(backends, cacheBackend{
+			name: "s3",
+			new: func(t *testing.T) Cache {
+				bucket := os.Getenv("S3_TEST_BUCKET")
+				if bucket == "" {
+					bucket = "toolbox-test"
+				}
+				c, err := NewS3Cache(S3CacheOptions{
+					Endpoint:  endpoint,
+					AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+					SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+					Bucket:    bucket,
+					// every test gets a prefix of its own in the shared bucket
+					Prefix: fmt.Sprintf("test-%d/", time.Now().UnixNano()),
+					UseSSL: os.Getenv("S3_TEST_USE_SSL") == "true",
+				})
+				if err != nil {
+					t.Fatalf("NewS3Cache: %v", err)
+				}
+				t.Cleanup(func() { c.DeletePrefix("") })
+				return c
+			},
+			// object modification times have a resolution of one second
+			tick: 1100 * time.Millisecond,
+		})
+	}
+
+	return backends
+}
+
+func TestCacheContract(t *testing.T) {
+	for _, b := range cacheBackends() {
+		t.Run(b.name, func(t *testing.T) {
+			t.Run("GetSetDelete", func(t *testing.T) { testCacheGetSetDelete(t, b.new(t)) })
+			t.Run("KeysAndDeletePrefix", func(t *testing.T) { testCacheKeys(t, b.new(t)) })
+			t.Run("Stats", func(t *testing.T) { testCacheStats(t, b.new(t), b.tick) })
+			t.Run("Purge", func(t *testing.T) { testCachePurge(t, b.new(t), b.tick) })
+			t.Run("Evict", func(t *testing.T) { testCacheEvict(t, b.new(t), b.tick, b.lru) })
+			t.Run("Versions", func(t *testing.T) { testCacheVersions(t, b.new(t), b.tick) })
+			t.Run("UnsafeKeys", func(t *testing.T) { testCacheUnsafeKeys(t, b.new(t)) })
+		})
+	}
+}
+
+func testCacheGetSetDelete(t *testing.T, c Cache) {
+	if _, found, err := c.Get("user_a"); err != nil || found {
+		t.Fatalf("Get before Set = found %v, error %v", found, err)
+	}
+
+	before := time.Now().Add(-time.Second)
+	mustSet(t, c, "user_a", testPNG)
+
+	entry := mustGet(t, c, "user_a")
+	if string(entry.Data) != string(testPNG) || entry.ContentType != "image/png" {
+		t.Errorf("Get = %q as %s", entry.Data, entry.ContentType)
+	}
+	if entry.StoredAt.Before(before) || entry.StoredAt.After(time.Now()) {
+		t.Errorf("StoredAt = %v, want about now", entry.StoredAt)
+	}
+
+	// an entry can change its type
+	mustSet(t, c, "user_a", testPDF)
+	if entry := mustGet(t, c, "user_a"); string(entry.Data) != string(testPDF) || entry.ContentType != "application/pdf" {
+		t.Errorf("Get after replacing = %q as %s", entry.Data, entry.ContentType)
+	}
+
+	if err := c.Delete("user_a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, found, err := c.Get("user_a"); err != nil || found {
+		t.Fatalf("Get after Delete = found %v, error %v", found, err)
+	}
+	if err := c.Delete("user_a"); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+}
+
+func testCacheKeys(t *testing.T, c Cache) {
+	for _, key := range []string{"alice_1", "alice_2", "bob_1"} {
+		mustSet(t, c, key, testPNG)
+	}
+
+	if keys := mustKeys(t, c, "alice_"); !slices.Equal(keys, []string{"alice_1", "alice_2"}) {
+		t.Errorf("Keys(alice_) = %v", keys)
+	}
+
+	removed, err := c.DeletePrefix("alice_")
+	if err != nil || removed != 2 {
+		t.Fatalf("DeletePrefix = %d, %v, want 2", removed, err)
+	}
+	if keys := mustKeys(t, c, ""); !slices.Equal(keys, []string{"bob_1"}) {
+		t.Errorf("Keys after DeletePrefix = %v", keys)
+	}
+}
+
+func testCacheStats(t *testing.T, c Cache, tick time.Duration) {
+	mustSet(t, c, "first", testPNG)
+	time.Sleep(tick)
+	mustSet(t, c, "second", testPDF)
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.Entries != 2 || stats.TotalBytes != int64(len(testPNG)+len(testPDF)) || stats.OldestKey != "first" {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
+
+func testCachePurge(t *testing.T, c Cache, tick time.Duration) {
+	mustSet(t, c, "old", testPNG)
+	time.Sleep(3 * tick)
+	mustSet(t, c, "new", testPNG)
+
+	if err := c.Purge(2 * tick); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if keys := mustKeys(t, c, ""); !slices.Equal(keys, []string{"new"}) {
+		t.Errorf("Keys after Purge = %v, want [new]", keys)
+	}
+}
+
+func testCacheEvict(t *testing.T, c Cache, tick time.Duration, lru bool) {
+	if !lru {
+		if err := c.Evict(1); !errors.Is(err, errEvictUnsupported) {
+			t.Errorf("Evict error = %v, want errEvictUnsupported", err)
+		}
+		return
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		mustSet(t, c, key, testPNG)
+		time.Sleep(tick)
+	}
+	// reading a makes b the least recently used
+	mustGet(t, c, "a")
+
+	if err := c.Evict(int64(2 * len(testPNG))); err != nil {
+		t.Fatalf("Evict: %v", err)
+	}
+	if keys := mustKeys(t, c, ""); !slices.Equal(keys, []string{"a", "c"}) {
+		t.Errorf("Keys after Evict = %v, want [a c]", keys)
+	}
+}
+
+func testCacheVersions(t *testing.T, c Cache, tick time.Duration) {
+	mustSet(t, c, "shot", testPNG)
+	first := mustGet(t, c, "shot").StoredAt
+
+	if err := c.Archive("shot"); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	time.Sleep(tick)
+	second := []byte("\x89PNG\r\n\x1a\n-second-")
+	mustSet(t, c, "shot", second)
+
+	versions, err := c.Versions("shot")
+	if err != nil || len(versions) != 1 || !versions[0].Equal(first) {
+		t.Fatalf("Versions = %v, %v, want [%v]", versions, err, first)
+	}
+
+	version, found, err := c.GetVersion("shot", versions[0])
+	if err != nil || !found || string(version.Data) != string(testPNG) {
+		t.Fatalf("GetVersion = %v, %v, %v", version, found, err)
+	}
+	if entry := mustGet(t, c, "shot"); string(entry.Data) != string(second) {
+		t.Errorf("Get after Archive = %q", entry.Data)
+	}
+
+	// versions are not entries
+	if stats, _ := c.Stats(); stats.Entries != 1 {
+		t.Errorf("Stats counts %d entries, want 1", stats.Entries)
+	}
+
+	// only screenshots are versioned
+	mustSet(t, c, "doc", testPDF)
+	if err := c.Archive("doc"); err != nil {
+		t.Fatalf("Archive of a PDF: %v", err)
+	}
+	if versions, _ := c.Versions("doc"); len(versions) != 0 {
+		t.Errorf("PDF has versions %v", versions)
+	}
+
+	if err := c.DeleteVersion("shot", versions[0]); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+	if versions, _ := c.Versions("shot"); len(versions) != 0 {
+		t.Errorf("Versions after DeleteVersion = %v", versions)
+	}
+}
+
+// testCacheUnsafeKeys stores keys built from raw request values, which may hold path separators.
+func testCacheUnsafeKeys(t *testing.T, c Cache) {
+	key := "../../escape/user_a"
+	mustSet(t, c, key, testPNG)
+	if err := c.Archive(key); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+
+	if entry := mustGet(t, c, key); string(entry.Data) != string(testPNG) {
+		t.Errorf("Get = %q", entry.Data)
+	}
+	if keys := mustKeys(t, c, "../"); !slices.Equal(keys, []string{key}) {
+		t.Errorf("Keys = %v", keys)
+	}
+	if versions, err := c.Versions(key); err != nil || len(versions) != 1 {
+		t.Errorf("Versions = %v, %v", versions, err)
+	}
+}
+
+func TestFileCacheKeepsKeysInside(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "cache", "screenshots")
+	c, err := NewFileCache(dir)
+	if err != nil {
+		t.Fatalf("NewFileCache: %v", err)
+	}
+
+	key := "../../escape/user_a"
+	mustSet(t, c, key, testPNG)
+	if err := c.Archive(key); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape")); !os.IsNotExist(err) {
+		t.Fatalf("a file was written outside the cache directory")
+	}
+
+	// the key survives a restart
+	reopened, err := NewFileCache(dir)
+	if err != nil {
+		t.Fatalf("NewFileCache: %v", err)
+	}
+	if keys := mustKeys(t, reopened, ""); !slices.Equal(keys, []string{key}) {
+		t.Errorf("Keys after reopening = %v", keys)
+	}
+	if versions, err := reopened.Versions(key); err != nil || len(versions) != 1 {
+		t.Errorf("Versions after reopening = %v, %v", versions, err)
+	}
+}
+
+func mustSet(t *testing.T, c Cache, key string, data []byte) {
+	t.Helper()
+	if err := c.Set(key, data); err != nil {
+		t.Fatalf("Set(%s): %v", key, err)
+	}
+}
+
+func mustGet(t *testing.T, c Cache, key string) *CacheEntry {
+	t.Helper()
+	entry, found, err := c.Get(key)
+	if err != nil || !found {
+		t.Fatalf("Get(%s) = found %v, error %v", key, found, err)
+	}
+	return entry
+}
+
+func mustKeys(t *testing.T, c Cache, prefix string) []string {
+	t.Helper()
+	keys, err := c.Keys(prefix)
+	if err != nil {
+		t.Fatalf("Keys(%s): %v", prefix, err)
+	}
+	slices.Sort(keys)
+	return keys
+}
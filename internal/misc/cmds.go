@@ -1,44 +1,72 @@
 package misc
 
 import (
+	"fmt"
+	"log"
 	"os"
-	"os/exec"
+
+	"github.com/creatorstation/toolbox/pkg/pptx"
+	"github.com/creatorstation/toolbox/pkg/video"
+	"github.com/creatorstation/toolbox/pkg/web"
 )
 
-// ReSavePPTX takes a path to a PPTX file and overwrites it with a new PPTX file.
-func ReSavePPTX(path string) error {
-	if err := exec.Command("unoconv", "-f", "pptx", "--output", path+"_new", path).Run(); err != nil {
+// EmbedVideos takes a path to a PPTX file, downloads every linked video and embeds it into the file.
+func EmbedVideos(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
 		return err
 	}
 
-	if err := os.Remove(path); err != nil {
+	pkg, err := pptx.Open(data)
+	if err != nil {
 		return err
 	}
 
-	if err := os.Rename(path+"_new.pptx", path); err != nil {
+	links, err := pkg.VideoLinks()
+	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// EmbedVideos takes a path to a PPTX file and embeds videos into it.
-func EmbedVideos(path string) error {
-	if err := ReSavePPTX(path); err != nil {
-		return err
+	// a video linked from several pictures is downloaded and thumbnailed once
+	type download struct {
+		video       []byte
+		contentType string
+		poster      []byte
 	}
+	downloads := map[string]download{}
 
-	if err := exec.Command("./PPTXCreator", path, path+"_embed").Run(); err != nil {
-		return err
-	}
+	for _, link := range links {
+		log.Printf("Embedding video into %s: %s", link.SlidePart, link.URL)
 
-	if err := os.Remove(path); err != nil {
-		return err
+		d, ok := downloads[link.URL]
+		if !ok {
+			media, err := web.FetchMedia(link.URL)
+			if err == nil {
+				err = media.Expect("video/*")
+			}
+			if err != nil {
+				return fmt.Errorf("could not download video %s: %w", link.URL, err)
+			}
+			d.video, d.contentType = media.Body, media.Type()
+
+			// a missing poster frame is not fatal, the picture's current image is kept instead
+			d.poster, err = video.Thumbnail(d.video)
+			if err != nil {
+				log.Printf("Could not generate poster frame for %s: %v", link.URL, err)
+				d.poster = nil
+			}
+			downloads[link.URL] = d
+		}
+
+		if err := pkg.EmbedVideo(link, d.video, d.contentType, d.poster); err != nil {
+			return err
+		}
 	}
 
-	if err := os.Rename(path+"_embed", path); err != nil {
+	out, err := pkg.Bytes()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return os.WriteFile(path, out, 0644)
 }
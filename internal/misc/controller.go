@@ -2,22 +2,151 @@ package misc
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/creatorstation/toolbox/pkg/img"
+	"github.com/creatorstation/toolbox/pkg/office"
+	"github.com/creatorstation/toolbox/pkg/pptx"
 	"github.com/creatorstation/toolbox/pkg/str"
+	"github.com/creatorstation/toolbox/pkg/web"
 	"github.com/gofiber/fiber/v2"
 )
 
 func MountController(router fiber.Router) {
+	if err := installPlaywrightBrowsers(); err != nil {
+		log.Fatalf("Failed to install Playwright browsers: %v", err)
+	}
+
+	if err := initCache(); err != nil {
+		log.Fatalf("Failed to initialize cache: %v", err)
+	}
+
+	if err := startWarmup(); err != nil {
+		log.Fatalf("Failed to start cache warm-up: %v", err)
+	}
+
 	router.Post("/slides-to-pptx", ConvertSlidesToPPTX)
+	router.Post("/pptx/inspect", InspectPPTX)
+	router.Post("/pptx/generate", GeneratePPTX)
+	router.Post("/office/convert", ConvertOfficeDocument)
+	router.Post("/screenshot", TakeScreenshot)
 	router.Get("/agi-screenshot", GetAGIScreenshot)
 	router.Get("/agi-screenshot-tab4", GetAGIScreenshotTab4)
+	router.Get("/agi-screenshot/:script", GetAGIScriptScreenshot)
+	router.Post("/agi-screenshot-batch", GetAGIScreenshotBatch)
+	router.Post("/agi-pdf", GetAGIPDF)
+	router.Get("/screenshot-cache/stats", GetScreenshotCacheStats)
+	router.Delete("/screenshot-cache", InvalidateScreenshotCache)
+	router.Get("/screenshot/versions", GetScreenshotVersions)
+	router.Post("/screenshot/diff", DiffScreenshots)
+	router.Get("/warmup/jobs", GetWarmupJobs)
+	router.Post("/warmup/run", RunWarmup)
+}
+
+// slidesExportStatus passes client errors of the Drive API on, like a token without access, and
+// reports its server errors as a bad gateway.
+func slidesExportStatus(err error) int {
+	var driveErr *web.DriveError
+	switch {
+	case errors.As(err, &driveErr) && driveErr.StatusCode < 500:
+		return driveErr.StatusCode
+	case errors.As(err, &driveErr):
+		return fiber.StatusBadGateway
+	case errors.Is(err, web.ErrTooLarge):
+		return fiber.StatusRequestEntityTooLarge
+	default:
+		return fiber.StatusInternalServerError
+	}
 }
 
 func ConvertSlidesToPPTX(c *fiber.Ctx) error {
+	var deck []byte
+
+	// either an already exported file is uploaded, or the presentation is exported from Google Slides
+	if file, err := c.FormFile("file"); err == nil {
+		fileContent, err := file.Open()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		defer fileContent.Close()
+
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(fileContent)
+		deck = buf.Bytes()
+	} else {
+		var body SlidesExportBody
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		if err := body.Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		log.Printf("Exporting Google Slides presentation: %s", body.PresentationID)
+
+		deck, err = web.ExportGoogleSlides(body.PresentationID, body.AccessToken)
+		if err != nil {
+			return c.Status(slidesExportStatus(err)).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	// creating a temporary directory in case of multiple files are being processed with the same name
+	tempDir, err := os.MkdirTemp("", "slides-to-pptx-*")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// generating a string for the path of the pptx file
+	fileName := str.RandomString(10)
+	pptxPath := filepath.Join(tempDir, fileName)
+
+	os.WriteFile(pptxPath, deck, 0644)
+
+	if err := EmbedVideos(pptxPath); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	respFile, err := os.ReadFile(pptxPath)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := os.RemoveAll(tempDir); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.Context().SetContentType("application/vnd.openxmlformats-officedocument.presentationml.presentation")
+	return c.Status(fiber.StatusOK).Send(respFile)
+}
+
+func InspectPPTX(c *fiber.Ctx) error {
 	file, err := c.FormFile("file")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -37,44 +166,160 @@ func ConvertSlidesToPPTX(c *fiber.Ctx) error {
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(fileContent)
 
-	// creating a temporary directory in case of multiple files are being processed with the same name
-	tempDir, err := os.MkdirTemp("", "slides-to-pptx-*")
+	inspection, err := pptx.Inspect(buf.Bytes())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(inspection)
+}
+
+func GeneratePPTX(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var body GeneratePPTXBody
+	if err := json.Unmarshal([]byte(c.FormValue("payload")), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("invalid payload: %v", err),
+		})
+	}
+
+	if err := body.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	fileContent, err := file.Open()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	// generating a string for the path of the pptx file
-	fileName := str.RandomString(10)
-	pptxPath := filepath.Join(tempDir, fileName)
+	defer fileContent.Close()
 
-	os.WriteFile(pptxPath, buf.Bytes(), 0644)
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(fileContent)
 
-	if err := EmbedVideos(pptxPath); err != nil {
+	deck, err := generateReport(buf.Bytes(), body)
+	var captureErr *CaptureError
+	if errors.Is(err, ErrAGIAuth) || errors.As(err, &captureErr) {
+		return sendCaptureError(c, err)
+	}
+	if errors.Is(err, web.ErrBlockedAddress) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, web.ErrUnexpectedType) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	respFile, err := os.ReadFile(pptxPath)
+	c.Context().SetContentType("application/vnd.openxmlformats-officedocument.presentationml.presentation")
+	return c.Status(fiber.StatusOK).Send(deck)
+}
+
+func ConvertOfficeDocument(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	inputFormat := strings.ToLower(c.FormValue("input_format", strings.TrimPrefix(filepath.Ext(file.Filename), ".")))
+	outputFormat := strings.ToLower(c.FormValue("output_format"))
+
+	if !office.Supported(inputFormat, outputFormat) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("unsupported conversion: %q to %q", inputFormat, outputFormat),
+		})
+	}
+
+	fileContent, err := file.Open()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	if err := os.RemoveAll(tempDir); err != nil {
+	defer fileContent.Close()
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(fileContent)
+
+	conv, err := officeConverter()
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	log.Printf("Converting office document %s from %s to %s", file.Filename, inputFormat, outputFormat)
+
+	output, err := conv.Convert(c.Context(), buf.Bytes(), inputFormat, outputFormat)
+	if errors.Is(err, office.ErrBusy) {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, office.ErrTimeout) {
+		return c.Status(fiber.StatusGatewayTimeout).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	c.Context().SetContentType("application/vnd.openxmlformats-officedocument.presentationml.presentation")
-	return c.Status(fiber.StatusOK).Send(respFile)
+	c.Context().SetContentType(office.ContentTypes[outputFormat])
+	return c.Status(fiber.StatusOK).Send(output)
 }
 
-var screenshotCache *ScreenshotCache
+var screenshotCache Cache
+
+func TakeScreenshot(c *fiber.Ctx) error {
+	var body ScreenshotBody
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := body.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	log.Printf("Taking screenshot: %s", body.URL)
+
+	imgBytes, contentType, err := captureScreenshot(body)
+	if err != nil {
+		log.Printf("Screenshot error: %v", err)
+		return sendCaptureError(c, err)
+	}
+
+	c.Set("Content-Type", contentType)
+	return c.Send(imgBytes)
+}
 
 func GetAGIScreenshot(c *fiber.Ctx) error {
 	username := c.Query("username")
@@ -84,22 +329,23 @@ func GetAGIScreenshot(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString("Missing username or elementId parameter")
 	}
 
-	cacheKey := fmt.Sprintf("%s_%s", username, elementID)
+	opts, err := parseCacheOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
 
-	if imgBytes, found := getCachedScreenshot(cacheKey); found {
-		c.Set("Content-Type", "image/png")
-		return c.Send(imgBytes)
+	output, err := parseOutputOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
 
-	imgBytes, err := takeScreenshot(username, elementID)
+	imgBytes, err := getOrTakeScreenshot(username, elementID, opts, output)
 	if err != nil {
 		log.Printf("Screenshot error: %v", err)
-		return c.Status(fiber.StatusInternalServerError).SendString("Failed to capture screenshot")
+		return sendCaptureError(c, err)
 	}
 
-	saveToCache(cacheKey, imgBytes)
-
-	c.Set("Content-Type", "image/png")
+	c.Set("Content-Type", output.contentType())
 	return c.Send(imgBytes)
 }
 
@@ -114,21 +360,444 @@ func GetAGIScreenshotTab4(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString("Missing username or elementId parameter")
 	}
 
-	cacheKey := fmt.Sprintf("%s_%s_tab4_%s_%s_%s", username, elementID, selectedDate, labelFilters, withLinkStory)
+	opts, err := parseCacheOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
 
-	if imgBytes, found := getCachedScreenshot(cacheKey); found {
-		c.Set("Content-Type", "image/png")
-		return c.Send(imgBytes)
+	output, err := parseOutputOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
 
-	imgBytes, err := takeScreenshotTab4(username, elementID, selectedDate, labelFilters, withLinkStory)
+	imgBytes, err := getOrTakeScreenshotTab4(username, elementID, selectedDate, labelFilters, withLinkStory, opts, output)
 	if err != nil {
 		log.Printf("Screenshot tab4 error: %v", err)
-		return c.Status(fiber.StatusInternalServerError).SendString("Failed to capture screenshot")
+		return sendCaptureError(c, err)
 	}
 
-	saveToCache(cacheKey, imgBytes)
+	c.Set("Content-Type", output.contentType())
+	return c.Send(imgBytes)
+}
 
-	c.Set("Content-Type", "image/png")
+func GetAGIScriptScreenshot(c *fiber.Ctx) error {
+	name := c.Params("script")
+
+	script, ok := getScript(name)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).SendString("Unknown script " + name)
+	}
+
+	opts, err := parseCacheOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	output, err := parseOutputOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	// cache and output controls are not script parameters and must not end up in the cache key
+	params := c.Queries()
+	delete(params, "refresh")
+	delete(params, "max_age")
+	delete(params, "debug")
+	for _, key := range outputQueryKeys {
+		delete(params, key)
+	}
+
+	for _, p := range script.Params {
+		if params[p] == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Missing " + p + " parameter")
+		}
+	}
+
+	imgBytes, err := getOrRunScriptOutput(name, script, opts, params, output)
+	if err != nil {
+		log.Printf("Screenshot script %s error: %v", name, err)
+		return sendCaptureError(c, err)
+	}
+
+	c.Set("Content-Type", output.contentType())
 	return c.Send(imgBytes)
 }
+
+func GetAGIScreenshotBatch(c *fiber.Ctx) error {
+	var body ScreenshotBatchBody
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := body.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if body.Script == "" {
+		body.Script = "tab3"
+	}
+
+	script, ok := getScript(body.Script)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "unknown script " + body.Script,
+		})
+	}
+
+	params := map[string]string{}
+	for k, v := range body.Params {
+		params[k] = v
+	}
+	params["username"] = body.Username
+
+	opts, err := parseCacheOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	output, err := parseOutputOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	output.applyParams(params)
+
+	images, failures, err := getOrRunScriptBatch(body.Script, script, opts, params, body.ElementIDs)
+	if err != nil {
+		log.Printf("Screenshot batch error: %v", err)
+		return sendCaptureError(c, err)
+	}
+
+	// the captures are cached by the batch, processing them again is cheaper than a lookup per variant
+	for id, capture := range images {
+		processed, err := output.process(capture)
+		if err != nil {
+			if failures == nil {
+				failures = map[string]error{}
+			}
+			delete(images, id)
+			failures[id] = err
+			continue
+		}
+		images[id] = processed
+	}
+
+	errs := fiber.Map{}
+	for id, err := range failures {
+		log.Printf("Screenshot batch error for %s: %v", id, err)
+		_, errs[id] = captureErrorBody(err)
+	}
+
+	if body.Format == "zip" {
+		archive, err := zipImages(images, body.ElementIDs, output.extension())
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		c.Context().SetContentType("application/zip")
+		return c.Status(fiber.StatusOK).Send(archive)
+	}
+
+	encoded := fiber.Map{}
+	for id, img := range images {
+		encoded[id] = base64.StdEncoding.EncodeToString(img)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"images": encoded,
+		"errors": errs,
+	})
+}
+
+func GetAGIPDF(c *fiber.Ctx) error {
+	var body AGIPDFBody
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := body.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if body.Script == "" {
+		body.Script = "tab3"
+	}
+
+	script, ok := getScript(body.Script)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "unknown script " + body.Script,
+		})
+	}
+
+	params := map[string]string{}
+	for k, v := range body.Params {
+		params[k] = v
+	}
+	params["username"] = body.Username
+
+	opts, err := parseCacheOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	pdf, err := getOrRunPDF(body.Script, script, opts, body, params)
+	if err != nil {
+		log.Printf("PDF error: %v", err)
+		return sendCaptureError(c, err)
+	}
+
+	c.Context().SetContentType("application/pdf")
+	return c.Status(fiber.StatusOK).Send(pdf)
+}
+
+func GetScreenshotCacheStats(c *fiber.Ctx) error {
+	stats, err := screenshotCache.Stats()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	hits, misses := cacheHits.Load(), cacheMisses.Load()
+	hitRatio, missRatio := 0.0, 0.0
+	if total := hits + misses; total > 0 {
+		hitRatio = float64(hits) / float64(total)
+		missRatio = float64(misses) / float64(total)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"entries":          stats.Entries,
+		"total_bytes":      stats.TotalBytes,
+		"max_bytes":        cacheMaxBytes,
+		"oldest_key":       stats.OldestKey,
+		"oldest_stored_at": stats.OldestStoredAt,
+		"hits":             hits,
+		"misses":           misses,
+		"hit_ratio":        hitRatio,
+		"miss_ratio":       missRatio,
+		"captures":         captureRuns.Load(),
+		"coalesced":        coalescedRequests.Load(),
+	})
+}
+
+// InvalidateScreenshotCache removes one entry by exact key, or every entry of a username.
+func InvalidateScreenshotCache(c *fiber.Ctx) error {
+	key := c.Query("key")
+	username := c.Query("username")
+
+	if (key == "") == (username == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "exactly one of key or username is required",
+		})
+	}
+
+	if key != "" {
+		if err := screenshotCache.Delete(key); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if _, err := screenshotCache.DeletePrefix(key + outputKeySeparator); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"key": key,
+		})
+	}
+
+	removed, err := screenshotCache.DeletePrefix(userKeyPrefix(username))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	log.Printf("Invalidated %d cached screenshots of %s", removed, username)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"removed": removed,
+	})
+}
+
+func GetWarmupJobs(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"jobs": cacheWarmer.History(),
+	})
+}
+
+func RunWarmup(c *fiber.Ctx) error {
+	run, err := cacheWarmer.Start("manual")
+	if errors.Is(err, ErrWarmupRunning) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(run)
+}
+
+func GetScreenshotVersions(c *fiber.Ctx) error {
+	key := c.Query("key")
+	if key == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "key is required",
+		})
+	}
+
+	versions, err := listVersions(key)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"key":      key,
+		"versions": versions,
+	})
+}
+
+// DiffScreenshots compares two versions of a screenshot. By default the cached capture is compared
+// with the version before it.
+func DiffScreenshots(c *fiber.Ctx) error {
+	var body ScreenshotDiffBody
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := body.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	key := body.Key
+	params := map[string]string{}
+	if key == "" {
+		if body.Script == "" {
+			body.Script = "tab3"
+		}
+		if _, ok := getScript(body.Script); !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "unknown script " + body.Script,
+			})
+		}
+
+		for k, v := range body.Params {
+			params[k] = v
+		}
+		params["username"] = body.Username
+		key = scriptCacheKey(body.Script, params)
+	}
+
+	if body.To == "" {
+		body.To = "current"
+	}
+
+	var before, after screenshotRef
+	var err error
+
+	if body.To == "fresh" {
+		// the cached capture is read first, the fresh one replaces it
+		if body.From == "" {
+			body.From = "current"
+		}
+		if before, err = resolveScreenshotRef(key, body.From, time.Time{}); err != nil {
+			return screenshotRefError(c, err)
+		}
+
+		script, _ := getScript(body.Script)
+		data, err := getOrRunScript(body.Script, script, CacheOptions{Refresh: true}, params)
+		if err != nil {
+			log.Printf("Screenshot diff capture error: %v", err)
+			return sendCaptureError(c, err)
+		}
+		after = screenshotRef{ID: "fresh", StoredAt: time.Now(), data: data}
+	} else {
+		if after, err = resolveScreenshotRef(key, body.To, time.Time{}); err != nil {
+			return screenshotRefError(c, err)
+		}
+		if before, err = resolveScreenshotRef(key, body.From, after.StoredAt); err != nil {
+			return screenshotRefError(c, err)
+		}
+	}
+
+	threshold := 16
+	if body.Threshold != nil {
+		threshold = *body.Threshold
+	}
+
+	diff, err := img.Diff(before.data, after.data, uint8(threshold))
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if body.Format == "png" {
+		c.Set("X-Changed-Percent", strconv.FormatFloat(diff.ChangedPercent, 'f', 4, 64))
+		c.Context().SetContentType("image/png")
+		return c.Send(diff.Image)
+	}
+
+	regions := make([]fiber.Map, 0, len(diff.Regions))
+	for _, r := range diff.Regions {
+		regions = append(regions, fiber.Map{
+			"x":      r.Min.X,
+			"y":      r.Min.Y,
+			"width":  r.Dx(),
+			"height": r.Dy(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"key":             key,
+		"from":            before,
+		"to":              after,
+		"width":           diff.Width,
+		"height":          diff.Height,
+		"changed_pixels":  diff.ChangedPixels,
+		"total_pixels":    diff.TotalPixels,
+		"changed_percent": diff.ChangedPercent,
+		"regions":         regions,
+		"image":           base64.StdEncoding.EncodeToString(diff.Image),
+	})
+}
+
+func screenshotRefError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errVersionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,29 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/creatorstation/toolbox/pkg/web"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSlidesExportStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("export: %w", &web.DriveError{StatusCode: fiber.StatusNotFound}), fiber.StatusNotFound},
+		{fmt.Errorf("export: %w", &web.DriveError{StatusCode: fiber.StatusUnauthorized}), fiber.StatusUnauthorized},
+		{fmt.Errorf("export: %w", &web.DriveError{StatusCode: fiber.StatusServiceUnavailable}), fiber.StatusBadGateway},
+		{fmt.Errorf("export: %w", web.ErrTooLarge), fiber.StatusRequestEntityTooLarge},
+		{errors.New("connection refused"), fiber.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if got := slidesExportStatus(tt.err); got != tt.want {
+			t.Errorf("slidesExportStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
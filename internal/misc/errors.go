@@ -0,0 +1,105 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Codes of failed AGI captures, returned in the code field of the error body.
+const (
+	CodeNavigationTimeout  = "navigation_timeout"
+	CodeDataTimeout        = "data_timeout"
+	CodeElementNotFound    = "element_not_found"
+	CodeAuthFailed         = "auth_failed"
+	CodeBrowserUnavailable = "browser_unavailable"
+	CodeCaptureFailed      = "capture_failed"
+	CodeInvalidParameter   = "invalid_parameter"
+	CodeHostNotAllowed     = "host_not_allowed"
+)
+
+var captureErrorStatus = map[string]int{
+	CodeNavigationTimeout:  fiber.StatusGatewayTimeout,
+	CodeDataTimeout:        fiber.StatusGatewayTimeout,
+	CodeElementNotFound:    fiber.StatusNotFound,
+	CodeAuthFailed:         fiber.StatusBadGateway,
+	CodeBrowserUnavailable: fiber.StatusServiceUnavailable,
+	CodeCaptureFailed:      fiber.StatusInternalServerError,
+	CodeInvalidParameter:   fiber.StatusBadRequest,
+	CodeHostNotAllowed:     fiber.StatusBadRequest,
+}
+
+// CaptureError is an AGI capture failure classified by what went wrong.
+type CaptureError struct {
+	Code string
+	Err  error
+	// Parameter and Choices describe a parameter value the page doesn't offer.
+	Parameter string
+	Choices   []string
+	Debug     *CaptureDebug
+}
+
+// CaptureDebug is the state of the page when a capture failed, attached when debug was requested.
+type CaptureDebug struct {
+	URL        string   `json:"url"`
+	Screenshot []byte   `json:"screenshot,omitempty"`
+	Console    []string `json:"console"`
+}
+
+func (e *CaptureError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CaptureError) Unwrap() error {
+	return e.Err
+}
+
+func captureErrorf(code, format string, args ...interface{}) error {
+	return &CaptureError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// classifyCaptureError returns the HTTP status and code of an error returned by a capture.
+func classifyCaptureError(err error) (int, string) {
+	code := CodeCaptureFailed
+
+	var captureErr *CaptureError
+	switch {
+	case errors.Is(err, ErrAGIAuth):
+		code = CodeAuthFailed
+	case errors.As(err, &captureErr):
+		code = captureErr.Code
+	case errors.Is(err, ErrPoolExhausted):
+		code = CodeBrowserUnavailable
+	}
+
+	return captureErrorStatus[code], code
+}
+
+// captureErrorBody is the JSON body describing a failed capture.
+func captureErrorBody(err error) (int, fiber.Map) {
+	status, code := classifyCaptureError(err)
+	body := fiber.Map{
+		"error": err.Error(),
+		"code":  code,
+	}
+
+	var captureErr *CaptureError
+	if errors.As(err, &captureErr) {
+		if captureErr.Parameter != "" {
+			body["parameter"] = captureErr.Parameter
+			body["choices"] = captureErr.Choices
+		}
+		if captureErr.Debug != nil {
+			body["debug"] = captureErr.Debug
+		}
+	}
+
+	return status, body
+}
+
+// sendCaptureError answers a failed AGI capture with its classified status and JSON body.
+func sendCaptureError(c *fiber.Ctx, err error) error {
+	status, body := captureErrorBody(err)
+	return c.Status(status).JSON(body)
+}
@@ -0,0 +1,176 @@
+package misc
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+const defaultHARDir = "./screenshot_har"
+
+// networkRules control the traffic of capture pages. They are configured by:
+//
+//	SCREENSHOT_BLOCK_RESOURCE_TYPES  comma separated resource types to abort, e.g. "media,font"
+//	SCREENSHOT_BLOCK_DOMAINS         comma separated hosts to abort, "*.example.com" matches subdomains
+//	SCREENSHOT_HAR_MODE              "record" saves the traffic of every AGI page load, "replay"
+//	                                 serves it from the recordings and aborts anything not recorded
+//	SCREENSHOT_HAR_DIR               directory of the recordings, ./screenshot_har by default
+type networkRules struct {
+	resourceTypes map[string]bool
+	domains       []string
+	harMode       string
+	harDir        string
+}
+
+var (
+	rules     *networkRules
+	rulesOnce sync.Once
+)
+
+func getNetworkRules() *networkRules {
+	rulesOnce.Do(func() {
+		rules = &networkRules{
+			resourceTypes: map[string]bool{},
+			domains:       splitList(os.Getenv("SCREENSHOT_BLOCK_DOMAINS")),
+			harMode:       os.Getenv("SCREENSHOT_HAR_MODE"),
+			harDir:        os.Getenv("SCREENSHOT_HAR_DIR"),
+		}
+		for _, t := range splitList(os.Getenv("SCREENSHOT_BLOCK_RESOURCE_TYPES")) {
+			rules.resourceTypes[strings.ToLower(t)] = true
+		}
+		if rules.harDir == "" {
+			rules.harDir = defaultHARDir
+		}
+
+		switch rules.harMode {
+		case "", "record", "replay":
+		default:
+			log.Printf("Unknown SCREENSHOT_HAR_MODE %s, HAR recording disabled", rules.harMode)
+			rules.harMode = ""
+		}
+	})
+	return rules
+}
+
+// apply installs the HAR routing and the block list on a context. harName is empty for pages that
+// are never recorded. Routes registered later run first, so blocked requests never reach the HAR.
+// A recording is written when the context closes; the returned function has to be called after
+// that and publishes it if the capture succeeded.
+func (n *networkRules) apply(ctx playwright.BrowserContext, harName string) (func(ok bool), error) {
+	finish := func(bool) {}
+	if n.harMode != "" && harName != "" {
+		var err error
+		if finish, err = n.routeFromHAR(ctx, harName); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(n.resourceTypes) == 0 && len(n.domains) == 0 {
+		return finish, nil
+	}
+
+	return finish, ctx.Route("**/*", func(route playwright.Route) {
+		if n.blocked(route.Request()) {
+			if err := route.Abort("blockedbyclient"); err != nil {
+				log.Printf("Failed to block request: %v", err)
+			}
+			return
+		}
+		if err := route.Fallback(); err != nil {
+			log.Printf("Failed to continue request: %v", err)
+		}
+	})
+}
+
+func (n *networkRules) blocked(req playwright.Request) bool {
+	if n.resourceTypes[req.ResourceType()] {
+		return true
+	}
+
+	u, err := url.Parse(req.URL())
+	if err != nil {
+		return false
+	}
+	return hostMatches(strings.ToLower(u.Hostname()), n.domains)
+}
+
+func (n *networkRules) routeFromHAR(ctx playwright.BrowserContext, harName string) (func(ok bool), error) {
+	path := filepath.Join(n.harDir, harName+".har")
+
+	if n.harMode == "record" {
+		recording, finish, err := newHARRecording(n.harDir, harName)
+		if err != nil {
+			return nil, err
+		}
+		err = ctx.RouteFromHAR(recording, playwright.BrowserContextRouteFromHAROptions{
+			Update:        playwright.Bool(true),
+			UpdateContent: playwright.RouteFromHarUpdateContentPolicyEmbed,
+		})
+		if err != nil {
+			finish(false)
+			return nil, err
+		}
+		return finish, nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("no HAR recording for %s: %w", harName, err)
+	}
+	return func(bool) {}, ctx.RouteFromHAR(path, playwright.BrowserContextRouteFromHAROptions{
+		NotFound: playwright.HarNotFoundAbort,
+	})
+}
+
+// newHARRecording returns a path of its own for one capture to record into, since captures of
+// the same page run concurrently. Its finish function renames a successful recording over the
+// replayed one and discards a failed one.
+func newHARRecording(dir, harName string) (string, func(ok bool), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, fmt.Errorf("could not create HAR directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, harName+".recording-*.har")
+	if err != nil {
+		return "", nil, fmt.Errorf("could not create HAR recording: %w", err)
+	}
+	f.Close()
+
+	recording := f.Name()
+	return recording, func(ok bool) {
+		if !ok {
+			if err := os.Remove(recording); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to remove HAR recording: %v", err)
+			}
+			return
+		}
+		if err := os.Rename(recording, filepath.Join(dir, harName+".har")); err != nil {
+			log.Printf("Failed to save HAR recording of %s: %v", harName, err)
+		}
+	}, nil
+}
+
+// harName names the recording of a script's page load. Element captures of the same page share
+// it, so a batch recording also replays single captures.
+func harName(name string, params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "elementId" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, params[k])
+	}
+	return fmt.Sprintf("%s_%s_%x", url.PathEscape(params["username"]), name, h.Sum(nil)[:8])
+}
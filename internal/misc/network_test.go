@@ -0,0 +1,90 @@
+package misc
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHARRecordingsArePerCapture(t *testing.T) {
+	dir := t.TempDir()
+
+	first, finishFirst, err := newHARRecording(dir, "page")
+	if err != nil {
+		t.Fatalf("newHARRecording: %v", err)
+	}
+	second, finishSecond, err := newHARRecording(dir, "page")
+	if err != nil {
+		t.Fatalf("newHARRecording: %v", err)
+	}
+	if first == second {
+		t.Fatalf("both captures record into %s", first)
+	}
+
+	// what the browser writes when each context closes
+	os.WriteFile(first, []byte("first"), 0644)
+	os.WriteFile(second, []byte("second"), 0644)
+
+	finishFirst(true)
+	finishSecond(false)
+
+	data, err := os.ReadFile(filepath.Join(dir, "page.har"))
+	if err != nil || string(data) != "first" {
+		t.Errorf("page.har = %q, %v, want the successful recording", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left in the HAR directory, want 1", len(entries))
+	}
+}
+
+// TestTab4Replay runs the builtin tab 4 script against a recorded page. It needs the Playwright
+// driver and Chromium and is skipped where they cannot be started.
+func TestTab4Replay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a browser")
+	}
+
+	params := map[string]string{
+		"username":      "testuser",
+		"elementId":     "engagement-rate",
+		"selectedDate":  "last-90-days",
+		"labelFilters":  "Reels,Stories",
+		"withLinkStory": "true",
+	}
+
+	dir := t.TempDir()
+	fixture, err := os.ReadFile("testdata/tab4.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, harName("tab4", params)+".har"), fixture, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SCREENSHOT_HAR_MODE", "replay")
+	t.Setenv("SCREENSHOT_HAR_DIR", dir)
+	t.Setenv("SCREENSHOT_BROWSERS", "1")
+	t.Setenv("AGI_TOKEN", "Bearer test")
+
+	pool, err := getBrowserPool()
+	if err != nil {
+		t.Skipf("no browser available: %v", err)
+	}
+	defer pool.Close()
+
+	script, _ := getScript("tab4")
+	capture, err := runAGIScript(script, params, newPageSession("tab4", params, CacheOptions{}))
+	if err != nil {
+		t.Fatalf("runAGIScript: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(capture))
+	if err != nil {
+		t.Fatalf("capture is not a PNG: %v", err)
+	}
+	if img.Bounds().Dx() == 0 || img.Bounds().Dy() == 0 {
+		t.Errorf("capture is empty: %v", img.Bounds())
+	}
+}
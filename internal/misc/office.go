@@ -0,0 +1,60 @@
+package misc
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/creatorstation/toolbox/pkg/office"
+)
+
+var (
+	officeMu   sync.Mutex
+	officeConv *office.Converter
+)
+
+// officeConverter lazily starts the LibreOffice worker pool, configured by OFFICE_WORKERS,
+// OFFICE_TIMEOUT, OFFICE_QUEUE_TIMEOUT, OFFICE_BASE_PORT and SOFFICE_PATH. A pool that failed to
+// start is not kept, the next call tries again.
+func officeConverter() (*office.Converter, error) {
+	officeMu.Lock()
+	defer officeMu.Unlock()
+
+	if officeConv != nil {
+		return officeConv, nil
+	}
+
+	workers, _ := strconv.Atoi(os.Getenv("OFFICE_WORKERS"))
+	if workers <= 0 {
+		workers = 2
+	}
+
+	timeout, err := time.ParseDuration(os.Getenv("OFFICE_TIMEOUT"))
+	if err != nil {
+		timeout = 2 * time.Minute
+	}
+
+	queueTimeout, err := time.ParseDuration(os.Getenv("OFFICE_QUEUE_TIMEOUT"))
+	if err != nil {
+		queueTimeout = 30 * time.Second
+	}
+
+	basePort, _ := strconv.Atoi(os.Getenv("OFFICE_BASE_PORT"))
+
+	log.Printf("Starting %d office workers", workers)
+	conv, err := office.NewConverter(office.Options{
+		Binary:       os.Getenv("SOFFICE_PATH"),
+		BasePort:     basePort,
+		Workers:      workers,
+		Timeout:      timeout,
+		QueueTimeout: queueTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	officeConv = conv
+	return officeConv, nil
+}
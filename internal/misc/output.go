@@ -0,0 +1,155 @@
+package misc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/creatorstation/toolbox/pkg/convert"
+	"github.com/creatorstation/toolbox/pkg/img"
+	"github.com/gofiber/fiber/v2"
+)
+
+// outputKeySeparator joins the key of a capture and the hash of the options of a processed variant.
+const outputKeySeparator = "_out_"
+
+// outputQueryKeys are the query parameters of OutputOptions, which are never script parameters.
+var outputQueryKeys = []string{"format", "quality", "width", "padding", "background", "transparent", "trim", "strip_headers"}
+
+func parseOutputOptions(c *fiber.Ctx) (OutputOptions, error) {
+	var o OutputOptions
+	if err := c.QueryParser(&o); err != nil {
+		return o, err
+	}
+	return o, o.Validate()
+}
+
+// processed reports whether the capture is changed after it was taken.
+func (o OutputOptions) processed() bool {
+	return (o.Format != "" && o.Format != "png") || o.Width > 0 || o.Padding > 0 || o.Background != "" ||
+		o.Transparent || o.Trim
+}
+
+func (o OutputOptions) contentType() string {
+	if o.Format == "" {
+		return screenshotContentTypes["png"]
+	}
+	return screenshotContentTypes[o.Format]
+}
+
+func (o OutputOptions) extension() string {
+	if o.Format == "" || o.Format == "png" {
+		return ".png"
+	}
+	if o.Format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + o.Format
+}
+
+// applyParams sets the script parameters that change the capture itself rather than its processing.
+func (o OutputOptions) applyParams(params map[string]string) {
+	if o.StripHeaders != nil && !*o.StripHeaders {
+		params["keepHeaders"] = "true"
+	}
+}
+
+// cacheKey derives the key of the processed image from the key of the capture.
+func (o OutputOptions) cacheKey(captureKey string) string {
+	// headers change the capture and are already part of its key
+	o.StripHeaders = nil
+	encoded, _ := json.Marshal(o)
+	hash := sha256.Sum256(encoded)
+	return fmt.Sprintf("%s%s%x", captureKey, outputKeySeparator, hash[:8])
+}
+
+// derivedBase returns the key of the capture a processed variant was made from.
+func derivedBase(key string) (string, bool) {
+	i := strings.LastIndex(key, outputKeySeparator)
+	if i < 0 {
+		return "", false
+	}
+
+	suffix := key[i+len(outputKeySeparator):]
+	if _, err := hex.DecodeString(suffix); err != nil || len(suffix) != 16 {
+		return "", false
+	}
+	return key[:i], true
+}
+
+// removeOrphanedOutputs deletes the processed variants whose capture was evicted or expired.
+func removeOrphanedOutputs() {
+	keys, err := screenshotCache.Keys("")
+	if err != nil {
+		log.Printf("Failed to list cache entries: %v", err)
+		return
+	}
+
+	captures := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		captures[key] = true
+	}
+
+	for _, key := range keys {
+		if base, ok := derivedBase(key); ok && !captures[base] {
+			if err := screenshotCache.Delete(key); err != nil {
+				log.Printf("Failed to remove orphaned output %s: %v", key, err)
+			}
+		}
+	}
+}
+
+func (o OutputOptions) process(capture []byte) ([]byte, error) {
+	if !o.processed() {
+		return capture, nil
+	}
+
+	opts := img.ProcessOptions{
+		JPEG:        o.Format == "jpeg",
+		Quality:     o.Quality,
+		Width:       o.Width,
+		Padding:     o.Padding,
+		Transparent: o.Transparent,
+		Trim:        o.Trim,
+	}
+	if o.Background != "" {
+		opts.Background, _ = img.ParseColor(o.Background)
+	}
+
+	out, err := img.Process(capture, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not process screenshot: %w", err)
+	}
+
+	// webp is encoded from the processed png since pkg/img only writes png and jpeg
+	if o.Format == "webp" {
+		quality := o.Quality
+		if quality == 0 {
+			quality = 90
+		}
+		return convert.ConvertImageToWebP(out, quality)
+	}
+
+	return out, nil
+}
+
+// getOrRunScriptOutput returns the capture of a script processed with the output options. The
+// processed image is cached under its own key, so the capture is shared by every variant.
+func getOrRunScriptOutput(name string, script Script, opts CacheOptions, params map[string]string, output OutputOptions) ([]byte, error) {
+	output.applyParams(params)
+
+	if !output.processed() {
+		return getOrRunScript(name, script, opts, params)
+	}
+
+	return getOrCapture(output.cacheKey(scriptCacheKey(name, params)), opts, func() ([]byte, error) {
+		capture, err := getOrRunScript(name, script, opts, params)
+		if err != nil {
+			return nil, err
+		}
+		return output.process(capture)
+	})
+}
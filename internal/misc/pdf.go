@@ -0,0 +1,106 @@
+package misc
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// getOrRunPDF returns the cached PDF of an AGI page, printing it on a miss.
+func getOrRunPDF(name string, script Script, opts CacheOptions, body AGIPDFBody, params map[string]string) ([]byte, error) {
+	return getOrCapture(pdfCacheKey(name, body, params), opts, func() ([]byte, error) {
+		return runAGIPDF(script, params, pdfOptions(body), newPageSession(name, params, opts))
+	})
+}
+
+// runAGIPDF runs the page preparing steps of a script and prints the page.
+func runAGIPDF(script Script, params map[string]string, options playwright.PagePdfOptions, session pageSession) ([]byte, error) {
+	for _, p := range script.Params {
+		if p != "elementId" && params[p] == "" {
+			return nil, fmt.Errorf("missing %s parameter", p)
+		}
+	}
+
+	var pdf []byte
+	err := withAGIPage(params, session, func(r *scriptRunner) error {
+		if _, err := r.execute(script.Steps[:elementStepsStart(script.Steps)], 0); err != ErrNoScreenshot {
+			if err == nil {
+				return fmt.Errorf("screenshot step has to reference elementId to print a page")
+			}
+			return err
+		}
+
+		var err error
+		if pdf, err = r.page.PDF(options); err != nil {
+			return fmt.Errorf("could not print pdf: %w", err)
+		}
+		return nil
+	})
+
+	return pdf, err
+}
+
+func pdfOptions(body AGIPDFBody) playwright.PagePdfOptions {
+	options := playwright.PagePdfOptions{
+		Landscape:       playwright.Bool(body.Landscape),
+		PrintBackground: playwright.Bool(body.PrintBackground == nil || *body.PrintBackground),
+		Margin: &playwright.Margin{
+			Top:    optionalString(body.MarginTop),
+			Right:  optionalString(body.MarginRight),
+			Bottom: optionalString(body.MarginBottom),
+			Left:   optionalString(body.MarginLeft),
+		},
+		PageRanges: optionalString(body.PageRanges),
+	}
+
+	options.Format = playwright.String("A4")
+	if body.Paper != "" {
+		options.Format = playwright.String(body.Paper)
+	}
+
+	if body.Scale != 0 {
+		options.Scale = playwright.Float(body.Scale)
+	}
+
+	// chromium only prints templates when both are enabled; an empty one hides its default
+	if body.HeaderTemplate != "" || body.FooterTemplate != "" {
+		options.DisplayHeaderFooter = playwright.Bool(true)
+		options.HeaderTemplate = playwright.String(orEmptySpan(body.HeaderTemplate))
+		options.FooterTemplate = playwright.String(orEmptySpan(body.FooterTemplate))
+	}
+
+	return options
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func orEmptySpan(template string) string {
+	if template == "" {
+		return "<span></span>"
+	}
+	return template
+}
+
+// pdfCacheKey starts with the username like the screenshot keys, so invalidating a username also
+// drops its PDFs. The print options are hashed since templates can be longer than a file name.
+func pdfCacheKey(name string, body AGIPDFBody, params map[string]string) string {
+	options := body
+	options.Username, options.Script, options.Params = "", "", nil
+	encoded, _ := json.Marshal(options)
+
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+
+	hash := sha256.Sum256(append([]byte(values.Encode()+"\n"), encoded...))
+	return fmt.Sprintf("%s_pdf_%s_%x", url.PathEscape(params["username"]), name, hash[:12])
+}
@@ -0,0 +1,375 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+const (
+	poolHealthInterval = 30 * time.Second
+	// poolRetryDelay spaces out launch attempts of a browser that failed to launch
+	poolRetryDelay = 5 * time.Second
+)
+
+// ErrPoolExhausted is returned when no browser context became free within the queue wait time.
+var ErrPoolExhausted = errors.New("no browser available")
+
+// PoolOptions configures the browser pool.
+type PoolOptions struct {
+	Browsers           int
+	ContextsPerBrowser int
+	MaxUses            int
+	MaxWait            time.Duration
+}
+
+type browserState int
+
+const (
+	browserReady browserState = iota
+	browserLaunching
+	browserDown
+)
+
+// BrowserPool keeps a set of warm Chromium instances behind one Playwright driver. Every browser
+// serves up to ContextsPerBrowser contexts at a time. A browser that served MaxUses contexts or
+// crashed takes no new contexts, and is relaunched in the background once its last one closed.
+type BrowserPool struct {
+	opts PoolOptions
+	all  []*pooledBrowser
+
+	// pwMu is held for reading by launches and for writing while the driver restarts
+	pwMu sync.RWMutex
+	pw   *playwright.Playwright
+
+	// mu guards the browser states and the fields below
+	mu         sync.Mutex
+	changed    chan struct{}
+	restarting bool
+	lastErr    error
+}
+
+type pooledBrowser struct {
+	id       int
+	browser  playwright.Browser
+	state    browserState
+	uses     int
+	active   int
+	draining bool
+	retryAt  time.Time
+}
+
+// BrowserLease is a browser context borrowed from the pool. Release must be called exactly once.
+type BrowserLease struct {
+	Context playwright.BrowserContext
+
+	pool *BrowserPool
+	pb   *pooledBrowser
+	once sync.Once
+}
+
+var (
+	browserPoolMu sync.Mutex
+	browserPool   *BrowserPool
+)
+
+// getBrowserPool lazily starts the shared pool, configured by SCREENSHOT_BROWSERS,
+// SCREENSHOT_CONTEXTS_PER_BROWSER, SCREENSHOT_BROWSER_MAX_USES and SCREENSHOT_QUEUE_WAIT.
+// A pool that failed to start is not kept, the next call tries again.
+func getBrowserPool() (*BrowserPool, error) {
+	browserPoolMu.Lock()
+	defer browserPoolMu.Unlock()
+
+	if browserPool != nil {
+		return browserPool, nil
+	}
+
+	pool, err := NewBrowserPool(PoolOptions{
+		Browsers:           envInt("SCREENSHOT_BROWSERS", 2),
+		ContextsPerBrowser: envInt("SCREENSHOT_CONTEXTS_PER_BROWSER", 2),
+		MaxUses:            envInt("SCREENSHOT_BROWSER_MAX_USES", 50),
+		MaxWait:            envDuration("SCREENSHOT_QUEUE_WAIT", 30*time.Second),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	browserPool = pool
+	return browserPool, nil
+}
+
+// NewBrowserPool starts the Playwright driver and launches the browsers.
+func NewBrowserPool(opts PoolOptions) (*BrowserPool, error) {
+	pw, err := playwright.Run()
+	if err != nil {
+		return nil, fmt.Errorf("could not start playwright: %w", err)
+	}
+
+	p := &BrowserPool{
+		opts:    opts,
+		pw:      pw,
+		changed: make(chan struct{}),
+	}
+
+	for i := 0; i < opts.Browsers; i++ {
+		browser, err := launchBrowser(pw)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.all = append(p.all, &pooledBrowser{id: i, browser: browser})
+	}
+
+	log.Printf("Browser pool started with %d browsers, %d contexts each", opts.Browsers, opts.ContextsPerBrowser)
+
+	go p.healthCheck()
+
+	return p, nil
+}
+
+// Acquire waits up to MaxWait for a free slot and opens a new context on a healthy browser.
+func (p *BrowserPool) Acquire(options playwright.BrowserNewContextOptions) (*BrowserLease, error) {
+	deadline := time.After(p.opts.MaxWait)
+
+	for {
+		p.mu.Lock()
+		pb := p.pick()
+		if pb == nil {
+			changed, lastErr := p.changed, p.lastErr
+			p.mu.Unlock()
+
+			select {
+			case <-changed:
+				continue
+			case <-deadline:
+				if lastErr != nil {
+					return nil, fmt.Errorf("%w after waiting %s, last failure: %v", ErrPoolExhausted, p.opts.MaxWait, lastErr)
+				}
+				return nil, fmt.Errorf("%w after waiting %s", ErrPoolExhausted, p.opts.MaxWait)
+			}
+		}
+
+		pb.active++
+		pb.uses++
+		// a worn-out browser drains, it keeps its open contexts but gets no new ones
+		if pb.uses >= p.opts.MaxUses {
+			pb.draining = true
+		}
+		browser := pb.browser
+		p.mu.Unlock()
+
+		context, err := browser.NewContext(options)
+		if err == nil {
+			return &BrowserLease{Context: context, pool: p, pb: pb}, nil
+		}
+
+		// the browser may have died since it was picked, retire it and try another one
+		log.Printf("Browser %d could not create context, retiring it: %v", pb.id, err)
+		p.mu.Lock()
+		pb.active--
+		pb.draining = true
+		p.lastErr = err
+		p.settle(pb)
+		p.mu.Unlock()
+	}
+}
+
+// Release closes the context and returns its slot to the pool.
+func (l *BrowserLease) Release() {
+	l.once.Do(func() {
+		if err := l.Context.Close(); err != nil {
+			log.Printf("Failed to close browser context: %v", err)
+		}
+
+		p := l.pool
+		p.mu.Lock()
+		l.pb.active--
+		p.settle(l.pb)
+		p.mu.Unlock()
+	})
+}
+
+// Close shuts down every browser and the Playwright driver.
+func (p *BrowserPool) Close() {
+	p.mu.Lock()
+	for _, pb := range p.all {
+		if pb.browser != nil {
+			pb.browser.Close()
+		}
+	}
+	p.mu.Unlock()
+
+	p.pwMu.Lock()
+	p.pw.Stop()
+	p.pwMu.Unlock()
+}
+
+// pick returns the ready browser with the fewest open contexts that can take another one, or
+// nil when none can. Crashed browsers found on the way are retired. The caller holds p.mu.
+func (p *BrowserPool) pick() *pooledBrowser {
+	if p.restarting {
+		return nil
+	}
+
+	var best *pooledBrowser
+	for _, pb := range p.all {
+		if pb.state == browserReady && !pb.browser.IsConnected() {
+			log.Printf("Browser %d is not connected, retiring it", pb.id)
+			pb.draining = true
+			p.settle(pb)
+		}
+		if pb.state == browserDown && time.Now().After(pb.retryAt) {
+			p.relaunch(pb)
+		}
+
+		if pb.state != browserReady || pb.draining || pb.active >= p.opts.ContextsPerBrowser {
+			continue
+		}
+		if best == nil || pb.active < best.active {
+			best = pb
+		}
+	}
+	return best
+}
+
+// settle relaunches a retired browser once its last context closed and wakes up waiting
+// callers. The caller holds p.mu.
+func (p *BrowserPool) settle(pb *pooledBrowser) {
+	if pb.state == browserReady && pb.draining && pb.active == 0 {
+		log.Printf("Browser %d retired after %d contexts, relaunching", pb.id, pb.uses)
+		p.relaunch(pb)
+	}
+	p.notify()
+}
+
+// notify wakes up every caller waiting for a browser. The caller holds p.mu.
+func (p *BrowserPool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// relaunch replaces an idle browser in the background, so a slow launch only holds up callers
+// that have no other browser to use. The caller holds p.mu.
+func (p *BrowserPool) relaunch(pb *pooledBrowser) {
+	old := pb.browser
+	pb.browser = nil
+	pb.state = browserLaunching
+
+	go func() {
+		if old != nil {
+			old.Close()
+		}
+
+		browser, err := p.launch(pb.id)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if err != nil {
+			log.Printf("Could not relaunch browser %d: %v", pb.id, err)
+			pb.state = browserDown
+			pb.retryAt = time.Now().Add(poolRetryDelay)
+			p.lastErr = err
+		} else {
+			pb.browser = browser
+			pb.state = browserReady
+			pb.uses = 0
+			pb.draining = false
+		}
+		p.notify()
+	}()
+}
+
+// launch starts a browser. When that fails the driver itself may be gone, so it is restarted, but
+// only while no context is open since every browser of the pool dies with it.
+func (p *BrowserPool) launch(id int) (playwright.Browser, error) {
+	p.pwMu.RLock()
+	browser, err := launchBrowser(p.pw)
+	p.pwMu.RUnlock()
+	if err == nil {
+		return browser, nil
+	}
+
+	if !p.restartDriver(id, err) {
+		return nil, err
+	}
+
+	p.pwMu.RLock()
+	defer p.pwMu.RUnlock()
+	return launchBrowser(p.pw)
+}
+
+// restartDriver restarts Playwright when no context is open and reports whether it did. The other
+// browsers are relaunched on the new driver.
+func (p *BrowserPool) restartDriver(id int, cause error) bool {
+	p.pwMu.Lock()
+	defer p.pwMu.Unlock()
+
+	p.mu.Lock()
+	for _, pb := range p.all {
+		if pb.active > 0 {
+			p.mu.Unlock()
+			return false
+		}
+	}
+	p.restarting = true
+	p.mu.Unlock()
+
+	log.Printf("Browser %d launch failed, restarting playwright: %v", id, cause)
+	p.pw.Stop()
+	pw, err := playwright.Run()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.restarting = false
+	if err != nil {
+		log.Printf("Could not restart playwright: %v", err)
+		p.lastErr = err
+		p.notify()
+		return false
+	}
+	p.pw = pw
+
+	// the browsers of the old driver are gone, idle ones are launched again on the new one
+	for _, pb := range p.all {
+		if pb.id != id && pb.state == browserReady {
+			pb.browser = nil
+			p.relaunch(pb)
+		}
+	}
+	p.notify()
+	return true
+}
+
+// healthCheck periodically retires crashed browsers and relaunches failed ones, so the next
+// request gets a warm one.
+func (p *BrowserPool) healthCheck() {
+	for {
+		time.Sleep(poolHealthInterval)
+
+		p.mu.Lock()
+		p.pick()
+		p.mu.Unlock()
+	}
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
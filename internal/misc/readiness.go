@@ -0,0 +1,131 @@
+package misc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+const (
+	// defaultNetworkQuiet is how long no request may be in flight before the network counts as idle.
+	defaultNetworkQuiet = 500 * time.Millisecond
+	// stableFrames is how many consecutive animation frames an element has to stay unchanged.
+	stableFrames = 5
+)
+
+// trackRequests counts the requests in flight so wait_for_network_idle also works after an
+// interaction, when the page load state has long been reached.
+func (r *scriptRunner) trackRequests() {
+	started := func(playwright.Request) {
+		r.mu.Lock()
+		r.inflight++
+		r.lastActivity = time.Now()
+		r.mu.Unlock()
+	}
+	ended := func(playwright.Request) {
+		r.mu.Lock()
+		if r.inflight > 0 {
+			r.inflight--
+		}
+		r.lastActivity = time.Now()
+		r.mu.Unlock()
+	}
+
+	r.page.OnRequest(started)
+	r.page.OnRequestFinished(ended)
+	r.page.OnRequestFailed(ended)
+}
+
+// waitForNetworkIdle waits until no request was in flight for the quiet period. The quiet period
+// also gives an interaction time to issue its requests before the network counts as idle.
+func (r *scriptRunner) waitForNetworkIdle(quiet, timeout time.Duration) error {
+	start := time.Now()
+	deadline := start.Add(timeout)
+
+	for {
+		r.mu.Lock()
+		inflight := r.inflight
+		last := r.lastActivity
+		r.mu.Unlock()
+
+		if last.Before(start) {
+			last = start
+		}
+		if inflight == 0 && time.Since(last) >= quiet {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return captureErrorf(CodeDataTimeout, "timeout waiting for network idle, %d requests in flight", inflight)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// waitForStable waits until the element keeps its bounding box and markup for stableFrames
+// animation frames, so charts are captured after their entry animation.
+func (r *scriptRunner) waitForStable(selector string, timeout time.Duration) error {
+	stable, err := r.page.Evaluate(`async ([selector, frames, timeout]) => {
+		const deadline = performance.now() + timeout;
+		let last = null;
+		let count = 0;
+		while (performance.now() < deadline) {
+			await new Promise(resolve => requestAnimationFrame(resolve));
+			const element = document.querySelector(selector);
+			if (!element) {
+				last = null;
+				count = 0;
+				continue;
+			}
+			const rect = element.getBoundingClientRect();
+			const state = [rect.x, rect.y, rect.width, rect.height].join(',') + element.innerHTML;
+			if (state === last) {
+				if (++count >= frames) return true;
+			} else {
+				last = state;
+				count = 0;
+			}
+		}
+		return false;
+	}`, []interface{}{selector, stableFrames, timeout.Milliseconds()})
+	if err != nil {
+		return fmt.Errorf("could not check element stability: %w", err)
+	}
+
+	if stable != true {
+		return captureErrorf(CodeDataTimeout, "timeout waiting for %s to stop changing", selector)
+	}
+	return nil
+}
+
+// waitForAssets waits for web fonts and for the images inside selector, or the whole page when
+// selector is empty, to be loaded and decoded.
+func (r *scriptRunner) waitForAssets(selector string, timeout time.Duration) error {
+	loaded, err := r.page.Evaluate(`async ([selector, timeout]) => {
+		const ready = (async () => {
+			await document.fonts.ready;
+			const root = selector ? document.querySelector(selector) : document;
+			if (!root) return;
+			await Promise.all(Array.from(root.querySelectorAll('img')).map(img => {
+				if (img.complete) {
+					return img.decode ? img.decode().catch(() => {}) : null;
+				}
+				return new Promise(resolve => {
+					img.addEventListener('load', resolve, { once: true });
+					img.addEventListener('error', resolve, { once: true });
+				});
+			}));
+		})();
+		const expired = new Promise(resolve => setTimeout(() => resolve(false), timeout));
+		return Promise.race([ready.then(() => true), expired]);
+	}`, []interface{}{selector, timeout.Milliseconds()})
+	if err != nil {
+		return fmt.Errorf("could not check assets: %w", err)
+	}
+
+	if loaded != true {
+		return captureErrorf(CodeDataTimeout, "timeout waiting for fonts and images")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package misc
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/creatorstation/toolbox/pkg/pptx"
+	"github.com/creatorstation/toolbox/pkg/web"
+)
+
+// generateReport fills a template deck with the text, images, AGI screenshots, tables and chart
+// data of the payload. Screenshots go through the screenshot cache like the AGI endpoints.
+func generateReport(template []byte, body GeneratePPTXBody) ([]byte, error) {
+	pkg, err := pptx.Open(template)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pkg.ReplaceText(body.Text); err != nil {
+		return nil, err
+	}
+
+	for key, uri := range body.Images {
+		image, err := web.FetchMedia(uri)
+		if err == nil {
+			err = image.Expect("image/*")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch image %s: %w", key, err)
+		}
+
+		if err := replaceImage(pkg, key, image.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, req := range body.Screenshots {
+		log.Printf("Capturing report screenshot %s: %s#%s", key, req.Username, req.ElementID)
+
+		var image []byte
+		if req.Tab == 4 {
+			image, err = getOrTakeScreenshotTab4(req.Username, req.ElementID, req.SelectedDate, req.LabelFilters, strconv.FormatBool(req.WithLinkStory), CacheOptions{}, OutputOptions{})
+		} else {
+			image, err = getOrTakeScreenshot(req.Username, req.ElementID, CacheOptions{}, OutputOptions{})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not capture screenshot %s: %w", key, err)
+		}
+
+		if err := replaceImage(pkg, key, image); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, rows := range body.Tables {
+		count, err := pkg.FillTable(key, rows)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("template has no table named %s", key)
+		}
+	}
+
+	for key, data := range body.Charts {
+		count, err := pkg.FillChart(key, data)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("template has no chart named %s", key)
+		}
+	}
+
+	return pkg.Bytes()
+}
+
+func replaceImage(pkg *pptx.Package, key string, image []byte) error {
+	count, err := pkg.ReplaceImage(key, image)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("template has no picture named %s", key)
+	}
+	return nil
+}
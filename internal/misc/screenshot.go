@@ -0,0 +1,254 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creatorstation/toolbox/pkg/convert"
+	"github.com/playwright-community/playwright-go"
+)
+
+const (
+	defaultAllowedHosts = "agi.creatorstation.com"
+	screenshotWaitTime  = 30 * time.Second
+)
+
+var screenshotContentTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"webp": "image/webp",
+	"pdf":  "application/pdf",
+}
+
+// checkAllowedHost validates a URL against SCREENSHOT_ALLOWED_HOSTS, a comma separated list of
+// hosts where "*.example.com" also matches every subdomain.
+func checkAllowedHost(value interface{}) error {
+	return allowedURL(value.(string))
+}
+
+// allowedURL checks a URL against the allowed hosts, for the requested URL as well as every page
+// the browser navigates to on the way.
+func allowedURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %s is not allowed", u.Scheme)
+	}
+
+	allowed := os.Getenv("SCREENSHOT_ALLOWED_HOSTS")
+	if allowed == "" {
+		allowed = defaultAllowedHosts
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if hostMatches(host, strings.Split(allowed, ",")) {
+		return nil
+	}
+
+	return fmt.Errorf("host %s is not allowed", host)
+}
+
+// hostMatches reports whether a lower case host equals one of the patterns, where "*.example.com"
+// matches every subdomain.
+func hostMatches(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureScreenshot loads an arbitrary page and returns the capture together with its content type.
+func captureScreenshot(body ScreenshotBody) ([]byte, string, error) {
+	format := body.Format
+	if format == "" {
+		format = "png"
+	}
+
+	scale := body.DeviceScaleFactor
+	if scale == 0 {
+		scale = 2.0
+	}
+
+	options := playwright.BrowserNewContextOptions{
+		DeviceScaleFactor: playwright.Float(scale),
+	}
+	if body.Viewport != nil {
+		options.Viewport = &playwright.Size{Width: body.Viewport.Width, Height: body.Viewport.Height}
+	}
+
+	pool, err := getBrowserPool()
+	if err != nil {
+		return nil, "", &CaptureError{Code: CodeBrowserUnavailable, Err: err}
+	}
+
+	lease, err := pool.Acquire(options)
+	if err != nil {
+		return nil, "", &CaptureError{Code: CodeBrowserUnavailable, Err: err}
+	}
+	defer lease.Release()
+
+	if _, err := getNetworkRules().apply(lease.Context, ""); err != nil {
+		return nil, "", fmt.Errorf("could not set up routes: %w", err)
+	}
+
+	// the validated URL may redirect or navigate a frame elsewhere; registered last, this route
+	// runs before the network rules
+	var (
+		blockedMu         sync.Mutex
+		blockedNavigation error
+	)
+	err = lease.Context.Route("**/*", func(route playwright.Route) {
+		req := route.Request()
+		if req.IsNavigationRequest() {
+			if err := allowedURL(req.URL()); err != nil {
+				blockedMu.Lock()
+				blockedNavigation = err
+				blockedMu.Unlock()
+				if err := route.Abort("blockedbyclient"); err != nil {
+					log.Printf("Failed to block navigation: %v", err)
+				}
+				return
+			}
+		}
+		if err := route.Fallback(); err != nil {
+			log.Printf("Failed to continue request: %v", err)
+		}
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("could not set up routes: %w", err)
+	}
+
+	page, err := lease.Context.NewPage()
+	if err != nil {
+		return nil, "", captureErrorf(CodeBrowserUnavailable, "could not create page: %w", err)
+	}
+
+	var waitForOperation func(time.Duration) error
+	if body.WaitForOperation != "" {
+		waitForOperation = expectGraphQLResponse(page, body.WaitForOperation)
+	}
+
+	gotoOptions := playwright.PageGotoOptions{}
+	if body.WaitForNetworkIdle {
+		gotoOptions.WaitUntil = playwright.WaitUntilStateNetworkidle
+	}
+	if _, err = page.Goto(body.URL, gotoOptions); err != nil {
+		blockedMu.Lock()
+		blocked := blockedNavigation
+		blockedMu.Unlock()
+		if blocked != nil {
+			return nil, "", captureErrorf(CodeHostNotAllowed, "could not navigate to page: %w", blocked)
+		}
+		if errors.Is(err, playwright.ErrTimeout) {
+			return nil, "", captureErrorf(CodeNavigationTimeout, "could not navigate to page: %w", err)
+		}
+		return nil, "", fmt.Errorf("could not navigate to page: %w", err)
+	}
+
+	// routes only see the first request of a redirect chain
+	if err := allowedURL(page.URL()); err != nil {
+		return nil, "", captureErrorf(CodeHostNotAllowed, "page was redirected: %w", err)
+	}
+
+	if waitForOperation != nil {
+		if err := waitForOperation(screenshotWaitTime); err != nil {
+			return nil, "", &CaptureError{Code: CodeDataTimeout, Err: err}
+		}
+	}
+
+	if body.WaitForSelector != "" {
+		if _, err := page.WaitForSelector(body.WaitForSelector); err != nil {
+			if errors.Is(err, playwright.ErrTimeout) {
+				return nil, "", captureErrorf(CodeDataTimeout, "could not find element %s: %w", body.WaitForSelector, err)
+			}
+			return nil, "", fmt.Errorf("could not find element %s: %w", body.WaitForSelector, err)
+		}
+	}
+
+	for _, selector := range body.Hide {
+		if _, err := page.EvalOnSelectorAll(selector, "els => els.forEach(el => el.style.setProperty('visibility', 'hidden', 'important'))"); err != nil {
+			return nil, "", fmt.Errorf("could not hide %s: %w", selector, err)
+		}
+	}
+
+	for _, selector := range body.Remove {
+		if _, err := page.EvalOnSelectorAll(selector, "els => els.forEach(el => el.remove())"); err != nil {
+			return nil, "", fmt.Errorf("could not remove %s: %w", selector, err)
+		}
+	}
+
+	if format == "pdf" {
+		pdf, err := page.PDF(playwright.PagePdfOptions{PrintBackground: playwright.Bool(true)})
+		if err != nil {
+			return nil, "", fmt.Errorf("could not print pdf: %w", err)
+		}
+		return pdf, screenshotContentTypes[format], nil
+	}
+
+	// webp is encoded from a lossless capture since playwright only produces png and jpeg
+	screenshotType := playwright.ScreenshotTypePng
+	var quality *int
+	if format == "jpeg" {
+		screenshotType = playwright.ScreenshotTypeJpeg
+		if body.Quality > 0 {
+			quality = playwright.Int(body.Quality)
+		}
+	}
+
+	var screenshot []byte
+	if body.Selector != "" {
+		elementHandle, err := page.WaitForSelector(body.Selector)
+		if errors.Is(err, playwright.ErrTimeout) {
+			return nil, "", captureErrorf(CodeElementNotFound, "could not find element: %w", err)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("could not find element: %w", err)
+		}
+
+		screenshot, err = elementHandle.Screenshot(playwright.ElementHandleScreenshotOptions{
+			Scale:   playwright.ScreenshotScaleDevice,
+			Type:    screenshotType,
+			Quality: quality,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("could not take screenshot: %w", err)
+		}
+	} else {
+		screenshot, err = page.Screenshot(playwright.PageScreenshotOptions{
+			FullPage: playwright.Bool(body.FullPage),
+			Scale:    playwright.ScreenshotScaleDevice,
+			Type:     screenshotType,
+			Quality:  quality,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("could not take screenshot: %w", err)
+		}
+	}
+
+	if format == "webp" {
+		quality := body.Quality
+		if quality == 0 {
+			quality = 90
+		}
+		if screenshot, err = convert.ConvertImageToWebP(screenshot, quality); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return screenshot, screenshotContentTypes[format], nil
+}
@@ -0,0 +1,953 @@
+package misc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultStepTimeout = 30 * time.Second
+
+var paramPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// Script is a named sequence of page interactions ending in a screenshot. Params lists the query
+// parameters a caller has to provide; every string field of a step may reference them as {{name}}.
+type Script struct {
+	Params []string `json:"params"`
+	Steps  []Step   `json:"steps"`
+}
+
+// ErrNoScreenshot is returned when a script ends without a screenshot step.
+var ErrNoScreenshot = errors.New("script has no screenshot step")
+
+// Step is a single interaction of a Script.
+//
+//	goto               navigate to URL
+//	wait_for_selector  wait until Selector is attached
+//	wait_for_response  wait for a successful GraphQL response named Operation, issued after the previous step started
+//	wait_for_network_idle  wait until no request was in flight for DurationMS (500ms by default)
+//	wait_for_stable    wait until the Selector element keeps its box and content across animation frames
+//	wait_for_assets    wait until fonts and the images inside Selector, or the page when empty, are loaded
+//	select_option      set the value of the Selector <select> to Value and dispatch change
+//	click_text         click the first Selector element whose text is Text; with Split, click one per item
+//	click_nth          click the Index-th element matching Selector, if there are that many
+//	type               type Value into Selector
+//	remove_elements    remove every element matching Selector
+//	sleep              pause for DurationMS
+//	screenshot         capture Selector, or the page when empty
+//
+// A failing Optional step is logged and the script goes on, which suits waits that only help.
+type Step struct {
+	Action     string `json:"action"`
+	URL        string `json:"url,omitempty"`
+	Selector   string `json:"selector,omitempty"`
+	Operation  string `json:"operation,omitempty"`
+	Value      string `json:"value,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Split      string `json:"split,omitempty"`
+	Index      int    `json:"index,omitempty"`
+	DurationMS int    `json:"duration_ms,omitempty"`
+	TimeoutMS  int    `json:"timeout_ms,omitempty"`
+	FullPage   bool   `json:"full_page,omitempty"`
+	// When names a parameter that has to be "true" for the step to run
+	When string `json:"when,omitempty"`
+	// Unless names a parameter that skips the step when it is "true"
+	Unless   string `json:"unless,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// references reports whether any string field of the step uses the {{name}} parameter.
+func (s Step) references(name string) bool {
+	for _, field := range []string{s.URL, s.Selector, s.Operation, s.Value, s.Text, s.When} {
+		for _, m := range paramPattern.FindAllStringSubmatch(field, -1) {
+			if m[1] == name {
+				return true
+			}
+		}
+	}
+	return s.When == name || s.Unless == name
+}
+
+// builtinScripts reproduce the original tab 3 and tab 4 captures; AGI_SCRIPTS_FILE can add to or
+// override them.
+var builtinScripts = map[string]Script{
+	"tab3": {
+		Params: []string{"username", "elementId"},
+		Steps: []Step{
+			{Action: "goto", URL: fmt.Sprintf(targetURL, "{{username}}")},
+			{Action: "wait_for_response", Operation: "Influencer"},
+			{Action: "wait_for_selector", Selector: "#{{elementId}}"},
+			{Action: "wait_for_stable", Selector: "#{{elementId}}"},
+			{Action: "wait_for_assets", Selector: "#{{elementId}}"},
+			{Action: "remove_elements", Selector: "#{{elementId}} h5", Unless: "keepHeaders"},
+			{Action: "screenshot", Selector: "#{{elementId}}"},
+		},
+	},
+	"tab4": {
+		Params: []string{"username", "elementId"},
+		Steps: []Step{
+			{Action: "goto", URL: fmt.Sprintf(targetURLTab4, "{{username}}")},
+			{Action: "wait_for_response", Operation: "Influencer"},
+			{Action: "wait_for_selector", Selector: "select"},
+			// every filter change queries the influencer again
+			{Action: "select_option", Selector: "select", Value: "{{selectedDate}}"},
+			{Action: "wait_for_response", Operation: "Influencer"},
+			{Action: "click_nth", Selector: ".form-multi-select-option.form-multi-select-option-with-checkbox", Index: 6, When: "withLinkStory"},
+			{Action: "wait_for_response", Operation: "Influencer", When: "withLinkStory"},
+			// no label filters means no query, so the last of their queries is only waited for briefly
+			{Action: "click_text", Selector: ".form-multi-select-option.form-multi-select-option-with-checkbox", Text: "{{labelFilters}}", Split: ","},
+			{Action: "wait_for_network_idle", DurationMS: 300, TimeoutMS: 3000, Optional: true},
+			{Action: "wait_for_selector", Selector: "#{{elementId}}"},
+			{Action: "wait_for_stable", Selector: "#{{elementId}}"},
+			{Action: "wait_for_assets", Selector: "#{{elementId}}"},
+			{Action: "remove_elements", Selector: "#{{elementId}} h5", Unless: "keepHeaders"},
+			{Action: "screenshot", Selector: "#{{elementId}}"},
+		},
+	},
+}
+
+var (
+	scriptsOnce sync.Once
+	scripts     map[string]Script
+)
+
+// getScript returns a builtin script or one loaded from AGI_SCRIPTS_FILE.
+func getScript(name string) (Script, bool) {
+	scriptsOnce.Do(func() {
+		scripts = make(map[string]Script, len(builtinScripts))
+		for k, s := range builtinScripts {
+			scripts[k] = s
+		}
+
+		path := os.Getenv("AGI_SCRIPTS_FILE")
+		if path == "" {
+			return
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Failed to read AGI scripts: %v", err)
+			return
+		}
+
+		var loaded map[string]Script
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			log.Printf("Failed to parse AGI scripts: %v", err)
+			return
+		}
+
+		for k, s := range loaded {
+			scripts[k] = s
+		}
+		log.Printf("Loaded %d AGI scripts from %s", len(loaded), path)
+	})
+
+	s, ok := scripts[name]
+	return s, ok
+}
+
+// captureGroup coalesces concurrent captures of the same cache key into one browser run.
+var (
+	captureGroup      singleflight.Group
+	captureRuns       atomic.Int64
+	coalescedRequests atomic.Int64
+)
+
+// getOrRunScript returns the cached result of a script, running it and caching the result on a miss.
+func getOrRunScript(name string, script Script, opts CacheOptions, params map[string]string) ([]byte, error) {
+	return getOrCapture(scriptCacheKey(name, params), opts, func() ([]byte, error) {
+		return runAGIScript(script, params, newPageSession(name, params, opts))
+	})
+}
+
+// getOrCapture returns the cached entry of a key, running capture and caching its result on a miss.
+func getOrCapture(cacheKey string, opts CacheOptions, capture func() ([]byte, error)) ([]byte, error) {
+	if imgBytes, found := getCachedScreenshot(cacheKey, opts); found {
+		return imgBytes, nil
+	}
+	return coalesceCapture(cacheKey, opts, capture)
+}
+
+// coalesceCapture runs capture and caches its result. Concurrent calls for the same key wait for a
+// single capture and all receive its result; debug requests only share captures with each other,
+// since only theirs attach the page state to failures.
+func coalesceCapture(cacheKey string, opts CacheOptions, capture func() ([]byte, error)) ([]byte, error) {
+	groupKey := cacheKey
+	if opts.Debug {
+		groupKey += "#debug"
+	}
+
+	executed := false
+	v, err, _ := captureGroup.Do(groupKey, func() (interface{}, error) {
+		executed = true
+		captureRuns.Add(1)
+
+		imgBytes, err := capture()
+		if err != nil {
+			return nil, err
+		}
+
+		saveToCache(cacheKey, imgBytes)
+		return imgBytes, nil
+	})
+
+	if !executed {
+		coalescedRequests.Add(1)
+		log.Printf("Coalesced screenshot request for %s", cacheKey)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]byte), nil
+}
+
+// getOrRunScriptBatch serves cached elements from the cache and captures the rest in one page load.
+// Every element still goes through coalesceCapture, so it joins a capture of the same element that
+// is already running and concurrent requests for it join the batch.
+func getOrRunScriptBatch(name string, script Script, opts CacheOptions, params map[string]string, elementIDs []string) (map[string][]byte, map[string]error, error) {
+	images := make(map[string][]byte, len(elementIDs))
+	keys := make(map[string]string, len(elementIDs))
+	var missing []string
+
+	for _, id := range elementIDs {
+		keys[id] = scriptCacheKey(name, withParam(params, "elementId", id))
+		if imgBytes, found := getCachedScreenshot(keys[id], opts); found {
+			images[id] = imgBytes
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) == 0 {
+		return images, nil, nil
+	}
+
+	// the page is loaded once, by whichever element capture runs first
+	var (
+		batchOnce     sync.Once
+		batchImages   map[string][]byte
+		batchFailures map[string]error
+		batchErr      error
+	)
+	runBatch := func() {
+		batchOnce.Do(func() {
+			batchImages, batchFailures, batchErr = runAGIScriptBatch(script, params, missing, newPageSession(name, params, opts))
+		})
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		failures map[string]error
+		pageErr  error
+	)
+	for _, id := range missing {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			// only set when this goroutine ran the capture, a coalesced one never reads the batch
+			pageFailed := false
+			imgBytes, err := coalesceCapture(keys[id], opts, func() ([]byte, error) {
+				runBatch()
+				if batchErr != nil {
+					pageFailed = true
+					return nil, batchErr
+				}
+				if err := batchFailures[id]; err != nil {
+					return nil, err
+				}
+				return batchImages[id], nil
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				images[id] = imgBytes
+			case pageFailed:
+				pageErr = err
+			default:
+				if failures == nil {
+					failures = map[string]error{}
+				}
+				failures[id] = err
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	if pageErr != nil {
+		return nil, nil, pageErr
+	}
+	return images, failures, nil
+}
+
+// withParam returns a copy of params with one more parameter set.
+func withParam(params map[string]string, key, value string) map[string]string {
+	copied := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+// runAGIScript runs a script on a pooled page authenticated against AGI.
+func runAGIScript(script Script, params map[string]string, session pageSession) ([]byte, error) {
+	for _, p := range script.Params {
+		if params[p] == "" {
+			return nil, fmt.Errorf("missing %s parameter", p)
+		}
+	}
+
+	var screenshot []byte
+	err := withAGIPage(params, session, func(r *scriptRunner) error {
+		var err error
+		screenshot, err = r.run(script.Steps)
+		return err
+	})
+
+	return screenshot, err
+}
+
+// runAGIScriptBatch loads the page once and captures several elements. Steps before the first one
+// that references {{elementId}} run once, the rest run for every element. Failures of single
+// elements are reported per element; the error is only set when the page itself could not be prepared.
+func runAGIScriptBatch(script Script, params map[string]string, elementIDs []string, session pageSession) (map[string][]byte, map[string]error, error) {
+	for _, p := range script.Params {
+		if p != "elementId" && params[p] == "" {
+			return nil, nil, fmt.Errorf("missing %s parameter", p)
+		}
+	}
+
+	split := elementStepsStart(script.Steps)
+
+	var images map[string][]byte
+	var failures map[string]error
+
+	err := withAGIPage(params, session, func(r *scriptRunner) error {
+		// a retry after a token renewal starts over
+		images = make(map[string][]byte, len(elementIDs))
+		failures = make(map[string]error)
+
+		if _, err := r.execute(script.Steps[:split], 0); err != ErrNoScreenshot {
+			if err == nil {
+				return fmt.Errorf("screenshot step has to reference elementId in a batch")
+			}
+			return err
+		}
+
+		for _, id := range elementIDs {
+			r.params["elementId"] = id
+
+			screenshot, err := r.run(script.Steps[split:])
+			if err != nil {
+				failures[id] = r.debugError(err)
+				continue
+			}
+			images[id] = screenshot
+		}
+
+		return nil
+	})
+
+	return images, failures, err
+}
+
+// elementStepsStart returns the index of the first step that references {{elementId}}; the steps
+// before it prepare the page, the rest capture an element.
+func elementStepsStart(steps []Step) int {
+	for i, step := range steps {
+		if step.references("elementId") {
+			return i
+		}
+	}
+	return len(steps)
+}
+
+// pageSession describes an AGI page load beyond its parameters.
+type pageSession struct {
+	// Debug attaches a full page screenshot and the console log to failures.
+	Debug bool
+	// HAR names the recording of the page traffic, see networkRules.
+	HAR string
+}
+
+func newPageSession(name string, params map[string]string, opts CacheOptions) pageSession {
+	return pageSession{Debug: opts.Debug, HAR: harName(name, params)}
+}
+
+// withAGIPage opens a pooled page authenticated against AGI and hands a runner for it to fn. When
+// AGI answers a request with 401 the token is renewed and fn runs once more on a new page.
+func withAGIPage(params map[string]string, session pageSession, fn func(r *scriptRunner) error) error {
+	auth := getAGIAuth()
+
+	for attempt := 0; ; attempt++ {
+		header, err := auth.Header()
+		if err != nil {
+			return err
+		}
+
+		unauthorized, err := runAGIPage(header, params, session, fn)
+		if !unauthorized {
+			return err
+		}
+
+		renewable := auth.Invalidate(header)
+		if err == nil {
+			return nil
+		}
+		if !renewable {
+			return fmt.Errorf("%w: AGI rejected the token and no AGI credentials are configured to renew it: %w", ErrAGIAuth, err)
+		}
+		if attempt > 0 {
+			return fmt.Errorf("%w: AGI rejected the renewed token: %w", ErrAGIAuth, err)
+		}
+
+		log.Printf("AGI rejected the token, renewing and retrying: %v", err)
+	}
+}
+
+// runAGIPage runs fn on a page sending the given Authorization header and reports whether AGI
+// answered any request with 401.
+func runAGIPage(header string, params map[string]string, session pageSession, fn func(r *scriptRunner) error) (_ bool, err error) {
+	pool, err := getBrowserPool()
+	if err != nil {
+		return false, &CaptureError{Code: CodeBrowserUnavailable, Err: err}
+	}
+
+	lease, err := pool.Acquire(playwright.BrowserNewContextOptions{
+		DeviceScaleFactor: playwright.Float(2.0),
+	})
+	if err != nil {
+		return false, &CaptureError{Code: CodeBrowserUnavailable, Err: err}
+	}
+	defer lease.Release()
+
+	finishHAR, err := getNetworkRules().apply(lease.Context, session.HAR)
+	if err != nil {
+		return false, fmt.Errorf("could not set up routes: %w", err)
+	}
+	defer func() {
+		// the recording is only complete once the context is closed
+		lease.Release()
+		finishHAR(err == nil)
+	}()
+
+	page, err := lease.Context.NewPage()
+	if err != nil {
+		return false, captureErrorf(CodeBrowserUnavailable, "could not create page: %w", err)
+	}
+
+	err = page.SetExtraHTTPHeaders(map[string]string{
+		"Authorization": header,
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not set headers: %w", err)
+	}
+
+	// only GraphQL requests carry the token, a 401 from other hosts says nothing about it
+	var unauthorized atomic.Bool
+	page.On("response", func(res playwright.Response) {
+		if res.Status() != 401 {
+			return
+		}
+		if pData, err := res.Request().PostData(); err == nil && strings.Contains(pData, `"operationName"`) {
+			unauthorized.Store(true)
+		}
+	})
+
+	// the runner may set parameters, so it gets its own copy
+	runnerParams := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		runnerParams[k] = v
+	}
+
+	r := newScriptRunner(page, runnerParams, session.Debug)
+	err = r.debugError(fn(r))
+	return unauthorized.Load(), err
+}
+
+// scriptRunner executes steps on a page. It records every GraphQL operation the page receives so
+// wait_for_response can't miss a response that arrived while the triggering step was running.
+type scriptRunner struct {
+	page   playwright.Page
+	params map[string]string
+
+	mu        sync.Mutex
+	responses []string
+	notify    chan struct{}
+
+	debug   bool
+	console []string
+
+	// requests in flight and the time the last one started or ended, for wait_for_network_idle
+	inflight     int
+	lastActivity time.Time
+}
+
+func newScriptRunner(page playwright.Page, params map[string]string, debug bool) *scriptRunner {
+	r := &scriptRunner{page: page, params: params, notify: make(chan struct{}, 1), debug: debug}
+	r.trackRequests()
+
+	if debug {
+		page.OnConsole(func(msg playwright.ConsoleMessage) {
+			r.mu.Lock()
+			r.console = append(r.console, fmt.Sprintf("[%s] %s", msg.Type(), msg.Text()))
+			r.mu.Unlock()
+		})
+		page.OnPageError(func(err error) {
+			r.mu.Lock()
+			r.console = append(r.console, fmt.Sprintf("[pageerror] %v", err))
+			r.mu.Unlock()
+		})
+	}
+
+	page.On("response", func(res playwright.Response) {
+		if res.Status() != 200 {
+			return
+		}
+
+		pData, err := res.Request().PostData()
+		if err != nil || pData == "" {
+			return
+		}
+
+		var body struct {
+			OperationName string `json:"operationName"`
+		}
+		if json.Unmarshal([]byte(pData), &body) != nil || body.OperationName == "" {
+			return
+		}
+
+		r.mu.Lock()
+		r.responses = append(r.responses, body.OperationName)
+		r.mu.Unlock()
+
+		select {
+		case r.notify <- struct{}{}:
+		default:
+		}
+	})
+
+	return r
+}
+
+// debugError attaches the page state to a failure when debugging is enabled.
+func (r *scriptRunner) debugError(err error) error {
+	if err == nil || !r.debug {
+		return err
+	}
+
+	_, code := classifyCaptureError(err)
+	debug := &CaptureDebug{URL: r.page.URL()}
+
+	screenshot, shotErr := r.page.Screenshot(playwright.PageScreenshotOptions{
+		FullPage: playwright.Bool(true),
+	})
+	if shotErr != nil {
+		log.Printf("Could not take debug screenshot: %v", shotErr)
+	}
+	debug.Screenshot = screenshot
+
+	r.mu.Lock()
+	debug.Console = append([]string{}, r.console...)
+	r.mu.Unlock()
+
+	captureErr := &CaptureError{Code: code, Err: err, Debug: debug}
+
+	var inner *CaptureError
+	if errors.As(err, &inner) {
+		captureErr.Parameter, captureErr.Choices = inner.Parameter, inner.Choices
+	}
+
+	return captureErr
+}
+
+// run executes steps until the screenshot step and returns its capture.
+func (r *scriptRunner) run(steps []Step) ([]byte, error) {
+	r.mu.Lock()
+	since := len(r.responses)
+	r.mu.Unlock()
+
+	return r.execute(steps, since)
+}
+
+// execute runs steps until a screenshot step, returning ErrNoScreenshot if there is none. Responses
+// from index since on count for a wait_for_response in the first step.
+func (r *scriptRunner) execute(steps []Step, since int) ([]byte, error) {
+	for i, step := range steps {
+		if step.When != "" && r.params[step.When] != "true" {
+			continue
+		}
+		if step.Unless != "" && r.params[step.Unless] == "true" {
+			continue
+		}
+
+		// responses that arrive from here on count for a wait_for_response right after this step
+		r.mu.Lock()
+		start := len(r.responses)
+		r.mu.Unlock()
+
+		if step.Action == "screenshot" {
+			return r.screenshot(step)
+		}
+
+		if err := r.runStep(step, since); err != nil {
+			if !step.Optional {
+				return nil, fmt.Errorf("step %d (%s): %w", i+1, step.Action, err)
+			}
+			log.Printf("Optional step %d (%s) failed, continuing: %v", i+1, step.Action, err)
+		}
+
+		since = start
+	}
+
+	return nil, ErrNoScreenshot
+}
+
+func (r *scriptRunner) runStep(step Step, since int) error {
+	timeout := defaultStepTimeout
+	if step.TimeoutMS > 0 {
+		timeout = time.Duration(step.TimeoutMS) * time.Millisecond
+	}
+
+	switch step.Action {
+	case "goto":
+		if _, err := r.page.Goto(r.expandURL(step.URL)); err != nil {
+			if errors.Is(err, playwright.ErrTimeout) {
+				return captureErrorf(CodeNavigationTimeout, "could not navigate to page: %w", err)
+			}
+			return fmt.Errorf("could not navigate to page: %w", err)
+		}
+
+	case "wait_for_selector":
+		if _, err := r.page.WaitForSelector(r.expandSelector(step.Selector), playwright.PageWaitForSelectorOptions{
+			Timeout: playwright.Float(float64(timeout.Milliseconds())),
+		}); err != nil {
+			// the element is missing when its ID is wrong, other selectors wait for the page data
+			if !errors.Is(err, playwright.ErrTimeout) {
+				return fmt.Errorf("could not find element: %w", err)
+			}
+			if step.references("elementId") {
+				return captureErrorf(CodeElementNotFound, "could not find element: %w", err)
+			}
+			return captureErrorf(CodeDataTimeout, "could not find element: %w", err)
+		}
+
+	case "wait_for_response":
+		return r.waitForResponse(r.expand(step.Operation), since, timeout)
+
+	case "wait_for_network_idle":
+		quiet := defaultNetworkQuiet
+		if step.DurationMS > 0 {
+			quiet = time.Duration(step.DurationMS) * time.Millisecond
+		}
+		return r.waitForNetworkIdle(quiet, timeout)
+
+	case "wait_for_stable":
+		return r.waitForStable(r.expandSelector(step.Selector), timeout)
+
+	case "wait_for_assets":
+		return r.waitForAssets(r.expandSelector(step.Selector), timeout)
+
+	case "select_option":
+		value := r.expand(step.Value)
+		if value != "" {
+			options, err := r.selectOptions(r.expandSelector(step.Selector))
+			if err != nil {
+				return err
+			}
+			if err := checkChoices(step.Value, []string{value}, options); err != nil {
+				return err
+			}
+		}
+
+		_, err := r.page.Evaluate(`([selector, value]) => {
+			const select = document.querySelector(selector);
+			if (!select) throw new Error('no element matches ' + selector);
+			select.focus();
+			select.value = value;
+			select.dispatchEvent(new Event('change', { bubbles: true }));
+		}`, []string{r.expandSelector(step.Selector), value})
+		if err != nil {
+			return fmt.Errorf("could not select option: %w", err)
+		}
+
+	case "click_text":
+		var texts []string
+		values := []string{r.expand(step.Text)}
+		if step.Split != "" {
+			values = strings.Split(values[0], step.Split)
+		}
+		for _, text := range values {
+			if text = strings.TrimSpace(text); text != "" {
+				texts = append(texts, text)
+			}
+		}
+
+		if len(texts) > 0 {
+			labels, err := r.texts(r.expandSelector(step.Selector))
+			if err != nil {
+				return err
+			}
+			if err := checkChoices(step.Text, texts, labels); err != nil {
+				return err
+			}
+		}
+
+		for _, text := range texts {
+			_, err := r.page.Evaluate(`([selector, text]) => {
+				for (const element of document.querySelectorAll(selector)) {
+					if ((element.innerText || element.textContent).trim() === text) {
+						element.click();
+						return;
+					}
+				}
+			}`, []string{r.expandSelector(step.Selector), text})
+			if err != nil {
+				return fmt.Errorf("could not click '%s': %w", text, err)
+			}
+		}
+
+	case "click_nth":
+		_, err := r.page.Evaluate(`([selector, index]) => {
+			const elements = document.querySelectorAll(selector);
+			if (elements.length > index) {
+				elements[index].click();
+			}
+		}`, []interface{}{r.expandSelector(step.Selector), step.Index})
+		if err != nil {
+			return fmt.Errorf("could not click element %d: %w", step.Index, err)
+		}
+
+	case "type":
+		if err := r.page.Locator(r.expandSelector(step.Selector)).PressSequentially(r.expand(step.Value)); err != nil {
+			return fmt.Errorf("could not type: %w", err)
+		}
+
+	case "remove_elements":
+		if _, err := r.page.EvalOnSelectorAll(r.expandSelector(step.Selector), "els => els.forEach(el => el.remove())"); err != nil {
+			return fmt.Errorf("could not remove elements: %w", err)
+		}
+
+	case "sleep":
+		time.Sleep(time.Duration(step.DurationMS) * time.Millisecond)
+
+	default:
+		return fmt.Errorf("unknown action")
+	}
+
+	return nil
+}
+
+func (r *scriptRunner) screenshot(step Step) ([]byte, error) {
+	if step.Selector == "" {
+		screenshot, err := r.page.Screenshot(playwright.PageScreenshotOptions{
+			FullPage: playwright.Bool(step.FullPage),
+			Scale:    playwright.ScreenshotScaleDevice,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not take screenshot: %w", err)
+		}
+		return screenshot, nil
+	}
+
+	elementHandle, err := r.page.WaitForSelector(r.expandSelector(step.Selector))
+	if errors.Is(err, playwright.ErrTimeout) {
+		return nil, captureErrorf(CodeElementNotFound, "could not find element: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not find element: %w", err)
+	}
+
+	screenshot, err := elementHandle.Screenshot(playwright.ElementHandleScreenshotOptions{
+		Scale: playwright.ScreenshotScaleDevice,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not take screenshot: %w", err)
+	}
+
+	return screenshot, nil
+}
+
+func (r *scriptRunner) waitForResponse(operation string, since int, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		r.mu.Lock()
+		for _, name := range r.responses[since:] {
+			if name == operation {
+				r.mu.Unlock()
+				return nil
+			}
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-r.notify:
+		case <-deadline:
+			return captureErrorf(CodeDataTimeout, "timeout waiting for %s response", operation)
+		}
+	}
+}
+
+// expand substitutes {{name}} parameters.
+func (r *scriptRunner) expand(s string) string {
+	return paramPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return r.params[paramPattern.FindStringSubmatch(m)[1]]
+	})
+}
+
+// texts returns the trimmed text of every element matching selector, as click_text compares it.
+func (r *scriptRunner) texts(selector string) ([]string, error) {
+	result, err := r.page.Evaluate(`selector => Array.from(document.querySelectorAll(selector),
+		element => (element.innerText || element.textContent).trim())`, selector)
+	if err != nil {
+		return nil, fmt.Errorf("could not read texts of %s: %w", selector, err)
+	}
+	return toStrings(result), nil
+}
+
+// selectOptions returns the option values of the first <select> matching selector.
+func (r *scriptRunner) selectOptions(selector string) ([]string, error) {
+	result, err := r.page.Evaluate(`selector => {
+		const select = document.querySelector(selector);
+		return select ? Array.from(select.options, option => option.value) : [];
+	}`, selector)
+	if err != nil {
+		return nil, fmt.Errorf("could not read options of %s: %w", selector, err)
+	}
+	return toStrings(result), nil
+}
+
+func toStrings(result interface{}) []string {
+	items, _ := result.([]interface{})
+	texts := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			texts = append(texts, s)
+		}
+	}
+	return texts
+}
+
+// checkChoices reports the values the page doesn't offer as an invalid_parameter error naming the
+// parameter the step field references, together with the available choices.
+func checkChoices(field string, values, choices []string) error {
+	offered := make(map[string]bool, len(choices))
+	for _, choice := range choices {
+		offered[choice] = true
+	}
+
+	var missing []string
+	for _, value := range values {
+		if !offered[value] {
+			missing = append(missing, value)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	parameter := field
+	if m := paramPattern.FindStringSubmatch(field); m != nil {
+		parameter = m[1]
+	}
+
+	return &CaptureError{
+		Code:      CodeInvalidParameter,
+		Err:       fmt.Errorf("%s: %s not available on the page", parameter, strings.Join(missing, ", ")),
+		Parameter: parameter,
+		Choices:   choices,
+	}
+}
+
+// expandSelector substitutes parameters escaped as CSS identifiers, so an element ID like "a.b"
+// or one with quotes matches literally instead of changing the selector.
+func (r *scriptRunner) expandSelector(s string) string {
+	return paramPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return cssEscape(r.params[paramPattern.FindStringSubmatch(m)[1]])
+	})
+}
+
+// cssEscape escapes a string like CSS.escape, for use as an identifier or inside a quoted value.
+func cssEscape(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+
+	for i, c := range runes {
+		switch {
+		case c == 0:
+			b.WriteRune('\uFFFD')
+		case c <= 0x1F || c == 0x7F,
+			i == 0 && c >= '0' && c <= '9',
+			i == 1 && c >= '0' && c <= '9' && runes[0] == '-':
+			fmt.Fprintf(&b, "\\%x ", c)
+		case i == 0 && c == '-' && len(runes) == 1:
+			b.WriteString("\\-")
+		case c >= 0x80, c == '-', c == '_',
+			c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			b.WriteRune(c)
+		default:
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+// expandURL substitutes parameters escaped for use inside a URL.
+func (r *scriptRunner) expandURL(s string) string {
+	return paramPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return url.PathEscape(r.params[paramPattern.FindStringSubmatch(m)[1]])
+	})
+}
+
+// userKeySeparator ends the username at the start of every cache key. Usernames are path escaped
+// in keys, so it never appears in one and a user's prefix matches no other user's keys.
+const userKeySeparator = "/"
+
+// userKeyPrefix returns the prefix of every cache key of username.
+func userKeyPrefix(username string) string {
+	return url.PathEscape(username) + userKeySeparator
+}
+
+// scriptCacheKey builds a cache key from the script name and its parameters, starting with the
+// username. The builtin scripts keep the rest of the keys of the original tab 3 and tab 4 endpoints.
+func scriptCacheKey(name string, params map[string]string) string {
+	var key string
+	switch name {
+	case "tab3":
+		key = params["elementId"]
+	case "tab4":
+		key = fmt.Sprintf("%s_tab4_%s_%s_%s", params["elementId"], params["selectedDate"], params["labelFilters"], params["withLinkStory"])
+	}
+	if key != "" {
+		// the original endpoints always stripped headers, so only captures keeping them get a new key
+		if params["keepHeaders"] == "true" {
+			key += "_headers"
+		}
+		return userKeyPrefix(params["username"]) + key
+	}
+
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	return userKeyPrefix(params["username"]) + fmt.Sprintf("%s_script_%s_%s", url.PathEscape(params["elementId"]), name, url.QueryEscape(values.Encode()))
+}
@@ -0,0 +1,87 @@
+package misc
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceCaptureKeepsDebugApart(t *testing.T) {
+	cache, err := NewFileCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	screenshotCache = cache
+
+	tests := []struct {
+		name  string
+		opts  []CacheOptions
+		calls int64
+	}{
+		{"plain", []CacheOptions{{}, {}}, 1},
+		{"debug and plain", []CacheOptions{{}, {Debug: true}}, 2},
+		{"debug", []CacheOptions{{Debug: true}, {Debug: true}}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int64
+			release := make(chan struct{})
+			capture := func() ([]byte, error) {
+				calls.Add(1)
+				<-release
+				return testPNG, nil
+			}
+
+			var wg sync.WaitGroup
+			for _, opts := range tt.opts {
+				wg.Add(1)
+				go func(opts CacheOptions) {
+					defer wg.Done()
+					if _, err := coalesceCapture("user_"+tt.name, opts, capture); err != nil {
+						t.Error(err)
+					}
+				}(opts)
+			}
+
+			// let both requests arrive before the capture finishes
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("captured %d times, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestWithParamCopies(t *testing.T) {
+	params := map[string]string{"username": "alice"}
+	withID := withParam(params, "elementId", "chart")
+
+	if _, ok := params["elementId"]; ok {
+		t.Error("withParam changed the original parameters")
+	}
+	if withID["elementId"] != "chart" || withID["username"] != "alice" {
+		t.Errorf("withParam = %v", withID)
+	}
+}
+
+func TestScriptCacheKeyUserPrefix(t *testing.T) {
+	prefix := userKeyPrefix("alice")
+	for _, username := range []string{"alice_bob", "alice.b", "alice/x"} {
+		for _, script := range []string{"tab3", "tab4", "custom"} {
+			key := scriptCacheKey(script, map[string]string{"username": username, "elementId": "el"})
+			if strings.HasPrefix(key, prefix) {
+				t.Errorf("key %s of %s starts with the prefix of alice", key, username)
+			}
+		}
+	}
+
+	if key := scriptCacheKey("tab3", map[string]string{"username": "alice", "elementId": "el"}); !strings.HasPrefix(key, prefix) {
+		t.Errorf("key %s does not start with %s", key, prefix)
+	}
+}
@@ -1,19 +1,271 @@
 package misc
 
 import (
-	"sync"
+	"errors"
+	"fmt"
+	"regexp"
 	"time"
+
+	"github.com/creatorstation/toolbox/pkg/img"
+	"github.com/creatorstation/toolbox/pkg/pptx"
+	"github.com/creatorstation/toolbox/pkg/web"
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
 )
 
-// ScreenshotCache stores and manages cached screenshots
-type ScreenshotCache struct {
-	cache     map[string]CacheItem
-	cachePath string
-	mu        sync.RWMutex
+// Cache stores screenshots by key. Implementations are selected by SCREENSHOT_CACHE_BACKEND.
+type Cache interface {
+	// Get returns the entry stored under key; found is false on a miss.
+	Get(key string) (entry *CacheEntry, found bool, err error)
+	Set(key string, data []byte) error
+	Delete(key string) error
+	// Purge removes entries stored more than maxAge ago and versions older than versionRetention.
+	Purge(maxAge time.Duration) error
+	// DeletePrefix removes every entry whose key starts with prefix and returns how many were removed.
+	DeletePrefix(prefix string) (int, error)
+	// Keys lists the keys starting with prefix.
+	Keys(prefix string) ([]string, error)
+	// Stats reports the number of entries, their total size and the oldest entry.
+	Stats() (CacheStats, error)
+	// Evict removes least recently used entries until the total size is at most maxBytes, or
+	// returns errEvictUnsupported.
+	Evict(maxBytes int64) error
+
+	// Archive copies the entry stored under key to its previous versions without counting as an
+	// access. Versions live apart from the entries: Keys, Stats, Evict and DeletePrefix ignore them,
+	// and Purge drops them after versionRetention.
+	Archive(key string) error
+	// Versions returns the store times of the previous versions of key.
+	Versions(key string) ([]time.Time, error)
+	GetVersion(key string, storedAt time.Time) (*CacheEntry, bool, error)
+	DeleteVersion(key string, storedAt time.Time) error
+}
+
+// CacheStats summarizes the content of a cache backend.
+type CacheStats struct {
+	Entries        int       `json:"entries"`
+	TotalBytes     int64     `json:"total_bytes"`
+	OldestKey      string    `json:"oldest_key,omitempty"`
+	OldestStoredAt time.Time `json:"oldest_stored_at,omitempty"`
+}
+
+// errEvictUnsupported is returned by backends that cannot evict by last access.
+var errEvictUnsupported = errors.New("cache backend does not support eviction")
+
+// CacheEntry is a cached screenshot and the time it was stored.
+type CacheEntry struct {
+	Data     []byte
+	StoredAt time.Time
+	// ContentType is sniffed from the data when it is stored.
+	ContentType string
+}
+
+// SlidesExportBody identifies a Google Slides presentation to export instead of uploading a file.
+type SlidesExportBody struct {
+	PresentationID string `json:"presentation_id" form:"presentation_id"`
+	AccessToken    string `json:"access_token" form:"access_token"`
+}
+
+func (b SlidesExportBody) Validate() error {
+	return v.ValidateStruct(&b,
+		v.Field(&b.PresentationID, v.Required, v.By(func(value interface{}) error {
+			_, err := web.PresentationID(value.(string))
+			return err
+		})),
+		v.Field(&b.AccessToken, v.Required),
+	)
+}
+
+// GeneratePPTXBody is the payload used to fill a template deck. Every map is keyed by the
+// placeholder name: {{key}} in text, or the shape name / alt text of pictures, tables and charts.
+type GeneratePPTXBody struct {
+	Text        map[string]string            `json:"text"`
+	Images      map[string]string            `json:"images"`
+	Screenshots map[string]ScreenshotRequest `json:"screenshots"`
+	Tables      map[string][][]string        `json:"tables"`
+	Charts      map[string]pptx.ChartData    `json:"charts"`
+}
+
+func (b GeneratePPTXBody) Validate() error {
+	for key, uri := range b.Images {
+		if err := v.Validate(uri, v.Required, is.URL); err != nil {
+			return fmt.Errorf("images.%s: %w", key, err)
+		}
+	}
+
+	for key, req := range b.Screenshots {
+		if err := req.Validate(); err != nil {
+			return fmt.Errorf("screenshots.%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// ScreenshotRequest describes an AGI element capture, with the same options as the screenshot endpoints.
+type ScreenshotRequest struct {
+	Username      string `json:"username"`
+	ElementID     string `json:"element_id"`
+	Tab           int    `json:"tab"`
+	SelectedDate  string `json:"selected_date"`
+	LabelFilters  string `json:"label_filters"`
+	WithLinkStory bool   `json:"with_link_story"`
+}
+
+func (r ScreenshotRequest) Validate() error {
+	return v.ValidateStruct(&r,
+		v.Field(&r.Username, v.Required),
+		v.Field(&r.ElementID, v.Required),
+		v.Field(&r.Tab, v.In(0, 3, 4)),
+	)
+}
+
+// ScreenshotBody describes a capture of an arbitrary page for the generic screenshot endpoint.
+type ScreenshotBody struct {
+	URL                string    `json:"url"`
+	Viewport           *Viewport `json:"viewport"`
+	DeviceScaleFactor  float64   `json:"device_scale_factor"`
+	Selector           string    `json:"selector"`
+	FullPage           bool      `json:"full_page"`
+	WaitForSelector    string    `json:"wait_for_selector"`
+	WaitForNetworkIdle bool      `json:"wait_for_network_idle"`
+	WaitForOperation   string    `json:"wait_for_operation"`
+	Hide               []string  `json:"hide"`
+	Remove             []string  `json:"remove"`
+	Format             string    `json:"format"`
+	Quality            int       `json:"quality"`
+}
+
+// Viewport is the browser window size in CSS pixels.
+type Viewport struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (b ScreenshotBody) Validate() error {
+	return v.ValidateStruct(&b,
+		v.Field(&b.URL, v.Required, is.URL, v.By(checkAllowedHost)),
+		v.Field(&b.Viewport),
+		v.Field(&b.DeviceScaleFactor, v.Min(0.0), v.Max(4.0)),
+		v.Field(&b.Selector, v.When(b.Format == "pdf", v.Empty.Error("cannot be combined with format pdf"))),
+		v.Field(&b.FullPage, v.When(b.Selector != "", v.Empty.Error("cannot be combined with selector"))),
+		v.Field(&b.Format, v.In("", "png", "jpeg", "webp", "pdf")),
+		v.Field(&b.Quality, v.Min(0), v.Max(100)),
+	)
+}
+
+func (vp Viewport) Validate() error {
+	return v.ValidateStruct(&vp,
+		v.Field(&vp.Width, v.Required, v.Min(1), v.Max(7680)),
+		v.Field(&vp.Height, v.Required, v.Min(1), v.Max(7680)),
+	)
+}
+
+// ScreenshotBatchBody requests several elements of the same AGI page in one page load.
+type ScreenshotBatchBody struct {
+	Script     string            `json:"script"`
+	Username   string            `json:"username"`
+	Params     map[string]string `json:"params"`
+	ElementIDs []string          `json:"element_ids"`
+	Format     string            `json:"format"`
+}
+
+func (b ScreenshotBatchBody) Validate() error {
+	return v.ValidateStruct(&b,
+		v.Field(&b.Username, v.Required),
+		v.Field(&b.ElementIDs, v.Required, v.Each(v.Required)),
+		v.Field(&b.Format, v.In("", "json", "zip")),
+	)
+}
+
+// ScreenshotDiffBody selects two versions of a cached screenshot to compare. The screenshot is named
+// either by its cache key or by the script, username and params that produce it. From and To take
+// a version ID, "current" for the cached capture or, for To only, "fresh" to capture it again.
+type ScreenshotDiffBody struct {
+	Key       string            `json:"key"`
+	Script    string            `json:"script"`
+	Username  string            `json:"username"`
+	Params    map[string]string `json:"params"`
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Threshold *int              `json:"threshold"`
+	Format    string            `json:"format"`
+}
+
+func (b ScreenshotDiffBody) Validate() error {
+	return v.ValidateStruct(&b,
+		v.Field(&b.Key, v.When(b.Username == "", v.Required.Error("key or username is required"))),
+		v.Field(&b.Username, v.When(b.Key != "", v.Empty.Error("cannot be combined with key"))),
+		v.Field(&b.From, v.NotIn("fresh").Error("fresh is only supported for to")),
+		v.Field(&b.To, v.When(b.To == "fresh", v.By(func(interface{}) error {
+			if b.Key != "" {
+				return errors.New("fresh needs username and script instead of key")
+			}
+			return nil
+		}))),
+		v.Field(&b.Threshold, v.Min(0), v.Max(255)),
+		v.Field(&b.Format, v.In("", "json", "png")),
+	)
+}
+
+// AGIPDFBody requests a PDF of a whole AGI page after the page preparing steps of a script, the
+// same tab and filter interactions that precede element captures.
+type AGIPDFBody struct {
+	Script          string            `json:"script"`
+	Username        string            `json:"username"`
+	Params          map[string]string `json:"params"`
+	Paper           string            `json:"paper"`
+	Landscape       bool              `json:"landscape"`
+	MarginTop       string            `json:"margin_top"`
+	MarginRight     string            `json:"margin_right"`
+	MarginBottom    string            `json:"margin_bottom"`
+	MarginLeft      string            `json:"margin_left"`
+	HeaderTemplate  string            `json:"header_template"`
+	FooterTemplate  string            `json:"footer_template"`
+	PrintBackground *bool             `json:"print_background"`
+	Scale           float64           `json:"scale"`
+	PageRanges      string            `json:"page_ranges"`
+}
+
+var cssLength = regexp.MustCompile(`^\d+(\.\d+)?(px|in|cm|mm)$`)
+
+func (b AGIPDFBody) Validate() error {
+	return v.ValidateStruct(&b,
+		v.Field(&b.Username, v.Required),
+		v.Field(&b.Paper, v.In("", "Letter", "Legal", "Tabloid", "Ledger", "A0", "A1", "A2", "A3", "A4", "A5", "A6")),
+		v.Field(&b.MarginTop, v.Match(cssLength)),
+		v.Field(&b.MarginRight, v.Match(cssLength)),
+		v.Field(&b.MarginBottom, v.Match(cssLength)),
+		v.Field(&b.MarginLeft, v.Match(cssLength)),
+		v.Field(&b.Scale, v.When(b.Scale != 0, v.Min(0.1), v.Max(2.0))),
+	)
+}
+
+// OutputOptions post-process AGI captures. They are read from the query of the screenshot endpoints.
+type OutputOptions struct {
+	Format       string `query:"format"`
+	Quality      int    `query:"quality"`
+	Width        int    `query:"width"`
+	Padding      int    `query:"padding"`
+	Background   string `query:"background"`
+	Transparent  bool   `query:"transparent"`
+	Trim         bool   `query:"trim"`
+	StripHeaders *bool  `query:"strip_headers"`
 }
 
-// CacheItem represents a single cached screenshot
-type CacheItem struct {
-	filePath  string
-	timestamp time.Time
+func (o OutputOptions) Validate() error {
+	return v.ValidateStruct(&o,
+		v.Field(&o.Format, v.In("", "png", "jpeg", "webp")),
+		v.Field(&o.Quality, v.Min(0), v.Max(100)),
+		v.Field(&o.Width, v.Min(0), v.Max(7680)),
+		v.Field(&o.Padding, v.Min(0), v.Max(1000)),
+		v.Field(&o.Background, v.By(func(value interface{}) error {
+			if value.(string) == "" {
+				return nil
+			}
+			_, err := img.ParseColor(value.(string))
+			return err
+		})),
+		v.Field(&o.Transparent, v.When(o.Format == "jpeg", v.Empty.Error("jpeg has no transparency"))),
+	)
 }
@@ -1,14 +1,20 @@
 package misc
 
 import (
+	"archive/zip"
+	"bytes"
 	"fmt"
 	"log"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/playwright-community/playwright-go"
 )
 
@@ -20,273 +26,251 @@ const (
 	targetURLTab4       = "https://agi.creatorstation.com/influencers/%s?tab=4"
 )
 
-func init() {
-	if err := initCache(); err != nil {
-		log.Fatalf("Failed to initialize cache: %v", err)
-	}
-
-	if err := installPlaywrightBrowsers(); err != nil {
-		log.Fatalf("Failed to install Playwright browsers: %v", err)
-	}
-
+// CacheOptions are the per-request cache controls of the screenshot endpoints.
+type CacheOptions struct {
+	// Refresh skips the cache lookup; the fresh capture still replaces the cached one.
+	Refresh bool
+	// MaxAge rejects cached entries older than this, on top of cacheExpirationTime.
+	MaxAge time.Duration
+	// Debug attaches a full page screenshot and the console log to capture failures.
+	Debug bool
 }
 
-func getCachedScreenshot(cacheKey string) ([]byte, bool) {
-	screenshotCache.mu.RLock()
-	cacheItem, exists := screenshotCache.cache[cacheKey]
-	screenshotCache.mu.RUnlock()
+var cacheHits, cacheMisses atomic.Int64
 
-	if !exists {
+func getCachedScreenshot(cacheKey string, opts CacheOptions) ([]byte, bool) {
+	if opts.Refresh {
+		cacheMisses.Add(1)
 		return nil, false
 	}
 
-	if time.Since(cacheItem.timestamp) < 12*time.Hour {
-		imgBytes, err := os.ReadFile(cacheItem.filePath)
-		if err == nil {
-			return imgBytes, true
-		}
-		log.Printf("Error reading cached screenshot: %v", err)
-	}
-	return nil, false
-}
-
-func takeScreenshot(username, elementID string) ([]byte, error) {
-	pw, browser, err := createPlaywrightBrowser()
-	if err != nil {
-		return nil, err
-	}
-	defer pw.Stop()
-	defer browser.Close()
-
-	context, err := browser.NewContext(playwright.BrowserNewContextOptions{
-		DeviceScaleFactor: playwright.Float(2.0),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("could not create context: %w", err)
-	}
-	defer context.Close()
-
-	page, err := context.NewPage()
-	if err != nil {
-		return nil, fmt.Errorf("could not create page: %w", err)
-	}
-
-	err = page.SetExtraHTTPHeaders(map[string]string{
-		"Authorization": os.Getenv("AGI_TOKEN"),
-	})
+	entry, exists, err := screenshotCache.Get(cacheKey)
 	if err != nil {
-		return nil, fmt.Errorf("could not set headers: %w", err)
-	}
-
-	url := fmt.Sprintf(targetURL, username)
-	if _, err = page.Goto(url); err != nil {
-		return nil, fmt.Errorf("could not navigate to page: %w", err)
-	}
-
-	if err := waitForCategoryResponse(page); err != nil {
-		return nil, err
-	}
-
-	selector := fmt.Sprintf("#%s", elementID)
-	elementHandle, err := page.WaitForSelector(selector)
-	if err != nil {
-		return nil, fmt.Errorf("could not find element: %w", err)
+		log.Printf("Error reading cached screenshot: %v", err)
+		cacheMisses.Add(1)
+		return nil, false
 	}
 
-	_, err = elementHandle.EvalOnSelectorAll("h5", "h5Elements => h5Elements.forEach(h5 => h5.remove())")
-	if err != nil {
-		return nil, fmt.Errorf("could not remove h5 elements: %w", err)
+	maxAge := cacheExpirationTime
+	if opts.MaxAge > 0 && opts.MaxAge < maxAge {
+		maxAge = opts.MaxAge
 	}
 
-	screenshot, err := elementHandle.Screenshot(playwright.ElementHandleScreenshotOptions{
-		Scale: playwright.ScreenshotScaleDevice,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("could not take screenshot: %w", err)
+	if exists && time.Since(entry.StoredAt) < maxAge {
+		cacheHits.Add(1)
+		return entry.Data, true
 	}
 
-	return screenshot, nil
+	cacheMisses.Add(1)
+	return nil, false
 }
 
-func takeScreenshotTab4(username, elementID, selectedDate, labelFilters, withLinkStory string) ([]byte, error) {
-	pw, browser, err := createPlaywrightBrowser()
-	if err != nil {
-		return nil, err
-	}
-	defer pw.Stop()
-	defer browser.Close()
-
-	context, err := browser.NewContext(playwright.BrowserNewContextOptions{
-		DeviceScaleFactor: playwright.Float(2.0),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("could not create context: %w", err)
-	}
-	defer context.Close()
-
-	page, err := context.NewPage()
-	if err != nil {
-		return nil, fmt.Errorf("could not create page: %w", err)
-	}
-
-	err = page.SetExtraHTTPHeaders(map[string]string{
-		"Authorization": os.Getenv("AGI_TOKEN"),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("could not set headers: %w", err)
-	}
-
-	url := fmt.Sprintf(targetURLTab4, username)
-	if _, err = page.Goto(url); err != nil {
-		return nil, fmt.Errorf("could not navigate to page: %w", err)
-	}
-
-	if err := waitForCategoryResponse(page); err != nil {
-		return nil, err
-	}
+// getOrTakeScreenshot returns the tab 3 screenshot of an element, capturing and caching it on a miss.
+func getOrTakeScreenshot(username, elementID string, opts CacheOptions, output OutputOptions) ([]byte, error) {
+	script, _ := getScript("tab3")
+	return getOrRunScriptOutput("tab3", script, opts, map[string]string{
+		"username":  username,
+		"elementId": elementID,
+	}, output)
+}
 
-	selectSelector := "select"
-	if _, err := page.WaitForSelector(selectSelector); err != nil {
-		return nil, fmt.Errorf("could not find select element: %w", err)
-	}
+// getOrTakeScreenshotTab4 returns the tab 4 screenshot of an element, capturing and caching it on a miss.
+func getOrTakeScreenshotTab4(username, elementID, selectedDate, labelFilters, withLinkStory string, opts CacheOptions, output OutputOptions) ([]byte, error) {
+	script, _ := getScript("tab4")
+	return getOrRunScriptOutput("tab4", script, opts, map[string]string{
+		"username":      username,
+		"elementId":     elementID,
+		"selectedDate":  selectedDate,
+		"labelFilters":  labelFilters,
+		"withLinkStory": withLinkStory,
+	}, output)
+}
 
-	time.Sleep(1 * time.Second)
+// zipImages packs images into a zip archive named by element ID and ext, in the requested order.
+func zipImages(images map[string][]byte, order []string, ext string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
 
-	_, err = page.Evaluate(fmt.Sprintf(`() => {
-		const select = document.querySelector('select');
-		select.focus();
-		select.value = '%s';
-		select.dispatchEvent(new Event('change', { bubbles: true }));
-	}`, selectedDate))
-	if err != nil {
-		return nil, fmt.Errorf("could not select option via JavaScript: %w", err)
-	}
+	for _, id := range order {
+		img, ok := images[id]
+		if !ok {
+			continue
+		}
 
-	// Handle withLinkStory checkbox - click element at index 6 if true
-	if withLinkStory == "true" {
-		_, err = page.Evaluate(`() => {
-			const elements = document.querySelectorAll('.form-multi-select-option.form-multi-select-option-with-checkbox');
-			if (elements.length > 6) {
-				elements[6].click();
-			}
-		}`)
+		w, err := zw.Create(url.PathEscape(id) + ext)
 		if err != nil {
-			return nil, fmt.Errorf("could not click withLinkStory checkbox at index 6: %w", err)
+			return nil, fmt.Errorf("could not add %s to archive: %w", id, err)
+		}
+		if _, err := w.Write(img); err != nil {
+			return nil, fmt.Errorf("could not add %s to archive: %w", id, err)
 		}
-		time.Sleep(500 * time.Millisecond)
 	}
 
-	// Handle labelFilters checkboxes
-	if labelFilters != "" {
-		filters := strings.Split(labelFilters, ",")
-		for _, filter := range filters {
-			filter = strings.TrimSpace(filter)
-			_, err = page.Evaluate(fmt.Sprintf(`() => {
-				const elements = document.querySelectorAll('.form-multi-select-option.form-multi-select-option-with-checkbox');
-				for (let element of elements) {
-					const text = (element.innerText || element.textContent).trim();
-					if (text === '%s') {
-						element.click();
-						break;
-					}
-				}
-			}`, filter))
-			if err != nil {
-				return nil, fmt.Errorf("could not click label filter checkbox for '%s': %w", filter, err)
-			}
-			time.Sleep(500 * time.Millisecond)
-		}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("could not finalize archive: %w", err)
 	}
 
-	time.Sleep(1 * time.Second)
+	return buf.Bytes(), nil
+}
 
-	selector := fmt.Sprintf("#%s", elementID)
-	elementHandle, err := page.WaitForSelector(selector)
-	if err != nil {
-		return nil, fmt.Errorf("could not find element: %w", err)
+// parseCacheOptions reads refresh=true and max_age=<seconds> from the query, falling back to a
+// Cache-Control request header (no-cache, max-age=N).
+func parseCacheOptions(c *fiber.Ctx) (CacheOptions, error) {
+	var opts CacheOptions
+
+	for _, directive := range strings.Split(c.Get(fiber.HeaderCacheControl), ",") {
+		directive = strings.TrimSpace(directive)
+		switch {
+		case directive == "no-cache":
+			opts.Refresh = true
+		case strings.HasPrefix(directive, "max-age="):
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && seconds >= 0 {
+				opts.MaxAge = time.Duration(seconds) * time.Second
+			}
+		}
 	}
 
-	time.Sleep(1 * time.Second)
+	opts.Debug = c.QueryBool("debug")
 
-	_, err = elementHandle.EvalOnSelectorAll("h5", "h5Elements => h5Elements.forEach(h5 => h5.remove())")
-	if err != nil {
-		return nil, fmt.Errorf("could not remove h5 elements: %w", err)
+	if refresh := c.Query("refresh"); refresh != "" {
+		opts.Refresh = refresh == "true"
 	}
 
-	screenshot, err := elementHandle.Screenshot(playwright.ElementHandleScreenshotOptions{
-		Scale: playwright.ScreenshotScaleDevice,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("could not take screenshot: %w", err)
+	if maxAge := c.Query("max_age"); maxAge != "" {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil || seconds < 0 {
+			return opts, fmt.Errorf("invalid max_age %q, expected seconds", maxAge)
+		}
+		// max_age=0 means only a fresh capture is acceptable
+		opts.MaxAge = time.Duration(seconds) * time.Second
+		opts.Refresh = opts.Refresh || seconds == 0
 	}
 
-	return screenshot, nil
+	return opts, nil
 }
 
-func createPlaywrightBrowser() (*playwright.Playwright, playwright.Browser, error) {
-	pw, err := playwright.Run()
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not start playwright: %w", err)
-	}
-
+func launchBrowser(pw *playwright.Playwright) (playwright.Browser, error) {
 	browser, err := pw.Chromium.Launch(playwright.BrowserTypeLaunchOptions{
 		Headless:        playwright.Bool(true),
 		Args:            []string{"--disable-gpu", "--no-sandbox", "--no-zygote"},
 		ChromiumSandbox: playwright.Bool(false),
 	})
 	if err != nil {
-		pw.Stop()
-		return nil, nil, fmt.Errorf("could not launch browser: %w", err)
+		return nil, fmt.Errorf("could not launch browser: %w", err)
 	}
 
-	return pw, browser, nil
+	return browser, nil
 }
 
-func waitForCategoryResponse(page playwright.Page) error {
+// expectGraphQLResponse starts listening for a successful GraphQL response with the given
+// operationName and returns a function that waits for it. Listening starts immediately so the
+// response can't be missed when it arrives before the wait.
+func expectGraphQLResponse(page playwright.Page, operationName string) func(timeout time.Duration) error {
 	responseChan := make(chan bool, 1)
+	marker := fmt.Sprintf("\"operationName\":\"%s\"", operationName)
+
 	page.On("response", func(res playwright.Response) {
+		// GraphQL operations are posted, other requests have no body to match
+		if res.Request().Method() != "POST" {
+			return
+		}
 		pData, err := res.Request().PostData()
 		if err != nil {
-			fmt.Println("Error getting post data", err)
+			log.Printf("Could not read post data of %s: %v", res.URL(), err)
 			return
 		}
-		if strings.Contains(pData, "\"operationName\":\"Influencer\"") && res.Status() == 200 {
-			responseChan <- true
+		if strings.Contains(pData, marker) && res.Status() == 200 {
+			select {
+			case responseChan <- true:
+			default:
+			}
 		}
 	})
 
-	select {
-	case <-responseChan:
-		return nil
-	case <-time.After(30 * time.Second):
-		return fmt.Errorf("timeout waiting for /stats/category response")
+	return func(timeout time.Duration) error {
+		select {
+		case <-responseChan:
+			return nil
+		case <-time.After(timeout):
+			return fmt.Errorf("timeout waiting for %s response", operationName)
+		}
 	}
 }
 
+// saveToCache stores a capture or a processed variant of one. Processed variants are not
+// versioned and live only as long as their capture, a new capture drops them.
 func saveToCache(cacheKey string, imgBytes []byte) {
-	cachePath := filepath.Join(screenshotCache.cachePath, cacheKey+".png")
-	if err := os.WriteFile(cachePath, imgBytes, 0644); err != nil {
+	_, derived := derivedBase(cacheKey)
+
+	// only screenshots have versions to compare, PDFs are simply replaced
+	if !derived && cacheContentType(imgBytes) == "image/png" {
+		archiveVersion(cacheKey)
+	}
+
+	if err := screenshotCache.Set(cacheKey, imgBytes); err != nil {
 		log.Printf("Failed to write screenshot to cache: %v", err)
 		return
 	}
 
-	screenshotCache.mu.Lock()
-	screenshotCache.cache[cacheKey] = CacheItem{
-		filePath:  cachePath,
-		timestamp: time.Now(),
+	if !derived {
+		if _, err := screenshotCache.DeletePrefix(cacheKey + outputKeySeparator); err != nil {
+			log.Printf("Failed to remove outputs of %s: %v", cacheKey, err)
+		}
 	}
-	screenshotCache.mu.Unlock()
+
+	if cacheMaxBytes > 0 {
+		if err := screenshotCache.Evict(cacheMaxBytes); err != nil {
+			log.Printf("Failed to evict cache entries: %v", err)
+		}
+		removeOrphanedOutputs()
+	}
+}
+
+// cacheContentType sniffs the type of cached data, without parameters.
+func cacheContentType(data []byte) string {
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return contentType
 }
 
+// cacheMaxBytes bounds the total cache size, least recently used entries are evicted beyond it
+var cacheMaxBytes int64
+
+// initCache creates the cache backend named by SCREENSHOT_CACHE_BACKEND: "fs" (default), "redis" or "s3".
+// SCREENSHOT_CACHE_MAX_BYTES enables LRU eviction and SCREENSHOT_CACHE_VERSIONS sets how many
+// previous versions are kept per key (0 disables them).
 func initCache() error {
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
+	var err error
+
+	cacheMaxBytes, _ = strconv.ParseInt(os.Getenv("SCREENSHOT_CACHE_MAX_BYTES"), 10, 64)
+	if n, err := strconv.Atoi(os.Getenv("SCREENSHOT_CACHE_VERSIONS")); err == nil && n >= 0 {
+		cacheVersions = n
 	}
 
-	screenshotCache = &ScreenshotCache{
-		cache:     make(map[string]CacheItem),
-		cachePath: cacheDir,
-		mu:        sync.RWMutex{},
+	switch backend := os.Getenv("SCREENSHOT_CACHE_BACKEND"); backend {
+	case "", "fs":
+		screenshotCache, err = NewFileCache(cacheDir)
+	case "redis":
+		screenshotCache, err = NewRedisCache(os.Getenv("REDIS_URL"), cacheExpirationTime)
+	case "s3":
+		if cacheMaxBytes > 0 {
+			return fmt.Errorf("SCREENSHOT_CACHE_MAX_BYTES is not supported by the s3 backend: %w", errEvictUnsupported)
+		}
+		screenshotCache, err = NewS3Cache(S3CacheOptions{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Prefix:    os.Getenv("S3_PREFIX"),
+			UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+		})
+	default:
+		err = fmt.Errorf("unknown cache backend %s", backend)
+	}
+	if err != nil {
+		return err
 	}
 
 	go cleanExpiredCache()
@@ -297,17 +281,10 @@ func cleanExpiredCache() {
 	for {
 		time.Sleep(cachePurgeInterval)
 
-		screenshotCache.mu.Lock()
-		now := time.Now()
-		for key, item := range screenshotCache.cache {
-			if now.Sub(item.timestamp) > cacheExpirationTime {
-				if err := os.Remove(item.filePath); err != nil {
-					log.Printf("Failed to remove expired cache file: %v", err)
-				}
-				delete(screenshotCache.cache, key)
-			}
+		if err := screenshotCache.Purge(cacheExpirationTime); err != nil {
+			log.Printf("Failed to purge expired cache entries: %v", err)
 		}
-		screenshotCache.mu.Unlock()
+		removeOrphanedOutputs()
 	}
 }
 
@@ -0,0 +1,158 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// versionSeparator joins a cache key and the store time of a previous version of it in the
+	// names backends give to versions.
+	versionSeparator = "~v"
+	// versionRetention is how long versions are kept, longer than the entries so they can still be
+	// compared against the next day's capture.
+	versionRetention = 7 * 24 * time.Hour
+)
+
+// cacheVersions is how many previous versions are kept per key, set by SCREENSHOT_CACHE_VERSIONS.
+var cacheVersions = 5
+
+// ScreenshotVersion is a previous capture kept under a cache key.
+type ScreenshotVersion struct {
+	ID       string    `json:"id"`
+	StoredAt time.Time `json:"stored_at"`
+}
+
+// versionKey names the version of key stored at storedAt.
+func versionKey(key string, storedAt time.Time) string {
+	return key + versionSeparator + strconv.FormatInt(storedAt.UnixNano(), 10)
+}
+
+// parseVersionKey splits a version key into the cache key and the version ID.
+func parseVersionKey(versionKey string) (key, id string, ok bool) {
+	i := strings.LastIndex(versionKey, versionSeparator)
+	if i < 0 {
+		return "", "", false
+	}
+
+	id = versionKey[i+len(versionSeparator):]
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return "", "", false
+	}
+
+	return versionKey[:i], id, true
+}
+
+// listVersions returns the previous versions of a cache key, newest first.
+func listVersions(key string) ([]ScreenshotVersion, error) {
+	times, err := screenshotCache.Versions(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not list versions: %w", err)
+	}
+
+	versions := make([]ScreenshotVersion, 0, len(times))
+	for _, t := range times {
+		versions = append(versions, ScreenshotVersion{ID: strconv.FormatInt(t.UnixNano(), 10), StoredAt: t})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].StoredAt.After(versions[j].StoredAt)
+	})
+
+	return versions, nil
+}
+
+// getVersion returns the data of a previous version of a cache key.
+func getVersion(key, id string) ([]byte, bool, error) {
+	nanos, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	entry, found, err := screenshotCache.GetVersion(key, time.Unix(0, nanos))
+	if err != nil || !found {
+		return nil, found, err
+	}
+	return entry.Data, true, nil
+}
+
+// archiveVersion keeps the entry currently stored under key as a previous version before it is
+// overwritten, dropping the oldest versions beyond cacheVersions.
+func archiveVersion(key string) {
+	if cacheVersions <= 0 {
+		return
+	}
+
+	if err := screenshotCache.Archive(key); err != nil {
+		log.Printf("Failed to keep previous screenshot version: %v", err)
+		return
+	}
+
+	versions, err := listVersions(key)
+	if err != nil {
+		log.Printf("Failed to trim screenshot versions: %v", err)
+		return
+	}
+
+	for _, old := range versions[min(len(versions), cacheVersions):] {
+		if err := screenshotCache.DeleteVersion(key, old.StoredAt); err != nil {
+			log.Printf("Failed to remove old screenshot version: %v", err)
+		}
+	}
+}
+
+var errVersionNotFound = errors.New("screenshot version not found")
+
+// screenshotRef is one side of a screenshot diff.
+type screenshotRef struct {
+	ID       string    `json:"id"`
+	StoredAt time.Time `json:"stored_at"`
+	data     []byte
+}
+
+// resolveScreenshotRef loads "current", a version ID, or with an empty ref the newest version
+// stored before the given time (any time when zero).
+func resolveScreenshotRef(key, ref string, before time.Time) (screenshotRef, error) {
+	switch ref {
+	case "current":
+		entry, found, err := screenshotCache.Get(key)
+		if err != nil {
+			return screenshotRef{}, fmt.Errorf("could not read cached screenshot: %w", err)
+		}
+		if !found {
+			return screenshotRef{}, fmt.Errorf("%w: no cached capture for %s", errVersionNotFound, key)
+		}
+		if !strings.HasPrefix(entry.ContentType, "image/") {
+			return screenshotRef{}, fmt.Errorf("%w: %s is not a screenshot", errVersionNotFound, key)
+		}
+		return screenshotRef{ID: "current", StoredAt: entry.StoredAt, data: entry.Data}, nil
+
+	case "":
+		versions, err := listVersions(key)
+		if err != nil {
+			return screenshotRef{}, err
+		}
+		for _, version := range versions {
+			if before.IsZero() || version.StoredAt.Before(before) {
+				return resolveScreenshotRef(key, version.ID, time.Time{})
+			}
+		}
+		return screenshotRef{}, fmt.Errorf("%w: no previous version of %s", errVersionNotFound, key)
+	}
+
+	data, found, err := getVersion(key, ref)
+	if err != nil {
+		return screenshotRef{}, fmt.Errorf("could not read screenshot version: %w", err)
+	}
+	if !found {
+		return screenshotRef{}, fmt.Errorf("%w: %s", errVersionNotFound, ref)
+	}
+
+	nanos, _ := strconv.ParseInt(ref, 10, 64)
+	return screenshotRef{ID: ref, StoredAt: time.Unix(0, nanos), data: data}, nil
+}
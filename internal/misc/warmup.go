@@ -0,0 +1,203 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creatorstation/toolbox/internal/db"
+	"github.com/creatorstation/toolbox/internal/models"
+	"github.com/robfig/cron/v3"
+)
+
+const warmupHistorySize = 50
+
+// ErrWarmupRunning is returned when a warm-up is triggered while another one is still running.
+var ErrWarmupRunning = errors.New("a warm-up job is already running")
+
+// WarmupRun is the history record of one cache warm-up.
+type WarmupRun struct {
+	ID         int       `json:"id"`
+	Trigger    string    `json:"trigger"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Usernames  int       `json:"usernames"`
+	Captured   int       `json:"captured"`
+	Failed     int       `json:"failed"`
+	Errors     []string  `json:"errors"`
+}
+
+// warmer pre-captures AGI screenshots so the morning reporting run is served from the cache.
+//
+// It is configured by:
+//
+//	WARMUP_SCHEDULE     cron spec, e.g. "CRON_TZ=Europe/Istanbul 30 5 * * *"; empty disables the schedule
+//	WARMUP_SOURCE       "config" (default) to use WARMUP_USERNAMES, or "db" to read the account table
+//	WARMUP_USERNAMES    comma separated usernames
+//	WARMUP_ELEMENT_IDS  comma separated element IDs captured for every username
+//	WARMUP_SCRIPT       capture script, "tab3" by default
+type warmer struct {
+	source     string
+	usernames  []string
+	elementIDs []string
+	script     string
+
+	running sync.Mutex
+	mu      sync.Mutex
+	history []WarmupRun
+	nextID  int
+}
+
+var cacheWarmer *warmer
+
+// startWarmup creates the warmer and schedules it when WARMUP_SCHEDULE is set.
+func startWarmup() error {
+	cacheWarmer = &warmer{
+		source:     os.Getenv("WARMUP_SOURCE"),
+		usernames:  splitList(os.Getenv("WARMUP_USERNAMES")),
+		elementIDs: splitList(os.Getenv("WARMUP_ELEMENT_IDS")),
+		script:     os.Getenv("WARMUP_SCRIPT"),
+	}
+	if cacheWarmer.script == "" {
+		cacheWarmer.script = "tab3"
+	}
+
+	schedule := os.Getenv("WARMUP_SCHEDULE")
+	if schedule == "" {
+		return nil
+	}
+
+	c := cron.New()
+	if _, err := c.AddFunc(schedule, func() {
+		if _, err := cacheWarmer.Start("schedule"); err != nil {
+			log.Printf("Scheduled warm-up skipped: %v", err)
+		}
+	}); err != nil {
+		return fmt.Errorf("invalid WARMUP_SCHEDULE: %w", err)
+	}
+	c.Start()
+
+	log.Printf("Screenshot cache warm-up scheduled: %s", schedule)
+	return nil
+}
+
+// Start launches a warm-up in the background and returns its history record.
+func (w *warmer) Start(trigger string) (WarmupRun, error) {
+	if !w.running.TryLock() {
+		return WarmupRun{}, ErrWarmupRunning
+	}
+
+	w.mu.Lock()
+	w.nextID++
+	run := WarmupRun{ID: w.nextID, Trigger: trigger, StartedAt: time.Now(), Errors: []string{}}
+	w.history = append(w.history, run)
+	if len(w.history) > warmupHistorySize {
+		w.history = w.history[len(w.history)-warmupHistorySize:]
+	}
+	w.mu.Unlock()
+
+	go func() {
+		defer w.running.Unlock()
+		w.run(run)
+	}()
+
+	return run, nil
+}
+
+// History returns the most recent runs, newest first.
+func (w *warmer) History() []WarmupRun {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	runs := make([]WarmupRun, len(w.history))
+	for i, run := range w.history {
+		runs[len(w.history)-1-i] = run
+	}
+	return runs
+}
+
+func (w *warmer) run(run WarmupRun) {
+	log.Printf("Warm-up %d started (%s)", run.ID, run.Trigger)
+
+	usernames, err := w.targets()
+	if err != nil {
+		run.Errors = append(run.Errors, err.Error())
+	}
+	run.Usernames = len(usernames)
+
+	script, ok := getScript(w.script)
+	if !ok {
+		run.Errors = append(run.Errors, "unknown script "+w.script)
+		usernames = nil
+	}
+
+	for _, username := range usernames {
+		if len(w.elementIDs) == 0 {
+			run.Errors = append(run.Errors, "WARMUP_ELEMENT_IDS is empty")
+			break
+		}
+
+		// refresh so the reporting run gets captures from this morning, not from the day before
+		images, failures, err := getOrRunScriptBatch(w.script, script, CacheOptions{Refresh: true}, map[string]string{"username": username}, w.elementIDs)
+		if err != nil {
+			run.Failed += len(w.elementIDs)
+			run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", username, err))
+			continue
+		}
+
+		run.Captured += len(images)
+		run.Failed += len(failures)
+		for id, err := range failures {
+			run.Errors = append(run.Errors, fmt.Sprintf("%s/%s: %v", username, id, err))
+		}
+	}
+
+	run.FinishedAt = time.Now()
+	log.Printf("Warm-up %d finished: %d captured, %d failed", run.ID, run.Captured, run.Failed)
+
+	w.mu.Lock()
+	for i := range w.history {
+		if w.history[i].ID == run.ID {
+			w.history[i] = run
+		}
+	}
+	w.mu.Unlock()
+}
+
+// targets returns the usernames to warm, from the configuration or the account table.
+func (w *warmer) targets() ([]string, error) {
+	if w.source != "db" {
+		return w.usernames, nil
+	}
+
+	// connecting on the first run keeps a database outage from taking the service down at startup
+	pg, err := db.OpenPG()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to database: %w", err)
+	}
+
+	var accounts []models.Account
+	if err := pg.Where("username <> ''").Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("could not load accounts: %w", err)
+	}
+
+	usernames := make([]string, 0, len(accounts))
+	for _, a := range accounts {
+		usernames = append(usernames, a.Username)
+	}
+	return usernames, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
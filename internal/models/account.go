@@ -0,0 +1,12 @@
+package models
+
+// Account represents the account table
+type Account struct {
+	ID       uint   `gorm:"primaryKey"`
+	Username string `gorm:"column:username"`
+}
+
+// TableName keeps gorm from using the pluralized "accounts".
+func (Account) TableName() string {
+	return "account"
+}
@@ -131,3 +131,29 @@ func ConvertQuicktimeToMP4(input []byte) ([]byte, error) {
 
 	return out.Bytes(), nil
 }
+
+func ConvertImageToWebP(input []byte, quality int) ([]byte, error) {
+	cmd := exec.Command(
+		"ffmpeg",
+		"-i", "pipe:0",
+		"-c:v", "libwebp",
+		"-quality", fmt.Sprint(quality),
+		"-f", "webp",
+		"pipe:1",
+		"-y",
+	)
+
+	cmd.Stdin = bytes.NewReader(input)
+
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg error: %v, details: %s", err, stderr.String())
+	}
+
+	return out.Bytes(), nil
+}
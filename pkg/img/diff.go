@@ -0,0 +1,155 @@
+package img
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+)
+
+// diffCell is the size of the grid used to group changed pixels into regions.
+const diffCell = 8
+
+// DiffResult describes what changed between two images.
+type DiffResult struct {
+	// Image is a PNG of the after image faded to gray, with changed pixels in red.
+	Image          []byte
+	Width          int
+	Height         int
+	ChangedPixels  int
+	TotalPixels    int
+	ChangedPercent float64
+	Regions        []image.Rectangle
+}
+
+// Diff compares two encoded images pixel by pixel. A pixel changed when any channel differs by
+// more than threshold (0-255). Images of different sizes are compared on the union of both
+// areas and pixels covered by only one of them count as changed.
+func Diff(before, after []byte, threshold uint8) (*DiffResult, error) {
+	a, _, err := image.Decode(bytes.NewReader(before))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding before image: %v", err)
+	}
+
+	b, _, err := image.Decode(bytes.NewReader(after))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding after image: %v", err)
+	}
+
+	ab, bb := a.Bounds(), b.Bounds()
+	width := max(ab.Dx(), bb.Dx())
+	height := max(ab.Dy(), bb.Dy())
+
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	cols := (width + diffCell - 1) / diffCell
+	rows := (height + diffCell - 1) / diffCell
+	cells := make([]image.Rectangle, cols*rows)
+
+	result := &DiffResult{Width: width, Height: height, TotalPixels: width * height}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			inA := x < ab.Dx() && y < ab.Dy()
+			inB := x < bb.Dx() && y < bb.Dy()
+
+			var ca, cb color.RGBA64
+			if inA {
+				ca = color.RGBA64Model.Convert(a.At(ab.Min.X+x, ab.Min.Y+y)).(color.RGBA64)
+			}
+			if inB {
+				cb = color.RGBA64Model.Convert(b.At(bb.Min.X+x, bb.Min.Y+y)).(color.RGBA64)
+			}
+
+			if inA != inB || channelDelta(ca, cb) > threshold {
+				result.ChangedPixels++
+				out.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+
+				cell := &cells[(y/diffCell)*cols+x/diffCell]
+				*cell = cell.Union(image.Rect(x, y, x+1, y+1))
+				continue
+			}
+
+			base := cb
+			if !inB {
+				base = ca
+			}
+			out.SetRGBA(x, y, faded(base))
+		}
+	}
+
+	if result.TotalPixels > 0 {
+		result.ChangedPercent = float64(result.ChangedPixels) * 100 / float64(result.TotalPixels)
+	}
+	result.Regions = regions(cells, cols, rows)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, fmt.Errorf("error encoding PNG: %v", err)
+	}
+	result.Image = buf.Bytes()
+
+	return result, nil
+}
+
+func channelDelta(a, b color.RGBA64) uint8 {
+	d := max(absDiff(a.R, b.R), absDiff(a.G, b.G), absDiff(a.B, b.B), absDiff(a.A, b.A))
+	return uint8(d >> 8)
+}
+
+func absDiff(a, b uint16) uint16 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// faded turns a pixel into a light gray so the changes stand out.
+func faded(c color.RGBA64) color.RGBA {
+	lum := (299*uint32(c.R>>8) + 587*uint32(c.G>>8) + 114*uint32(c.B>>8)) / 1000
+	lum = lum*uint32(c.A>>8)/255 + 255 - uint32(c.A>>8)
+	g := uint8(lum/3 + 170)
+	return color.RGBA{R: g, G: g, B: g, A: 255}
+}
+
+// regions merges neighbouring grid cells with changes into bounding boxes.
+func regions(cells []image.Rectangle, cols, rows int) []image.Rectangle {
+	seen := make([]bool, len(cells))
+	var boxes []image.Rectangle
+
+	for start := range cells {
+		if seen[start] || cells[start].Empty() {
+			continue
+		}
+
+		box := image.Rectangle{}
+		stack := []int{start}
+		seen[start] = true
+
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			box = box.Union(cells[i])
+
+			cx, cy := i%cols, i/cols
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := cx+dx, cy+dy
+					if nx < 0 || ny < 0 || nx >= cols || ny >= rows {
+						continue
+					}
+					n := ny*cols + nx
+					if !seen[n] && !cells[n].Empty() {
+						seen[n] = true
+						stack = append(stack, n)
+					}
+				}
+			}
+		}
+
+		boxes = append(boxes, box)
+	}
+
+	return boxes
+}
@@ -0,0 +1,119 @@
+package img
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+var (
+	white = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	black = color.RGBA{A: 255}
+	red   = color.RGBA{R: 255, A: 255}
+)
+
+// filled returns an image of one color.
+func filled(w, h int, c color.Color) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(m, m.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return m
+}
+
+func encodePNG(t *testing.T, m image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, m); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decode(t *testing.T, data []byte) image.Image {
+	t.Helper()
+
+	m, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return m
+}
+
+func TestDiff(t *testing.T) {
+	before := filled(20, 10, white)
+	before.SetRGBA(0, 9, black)
+
+	after := filled(20, 10, white)
+	after.SetRGBA(0, 9, black)
+	draw.Draw(after, image.Rect(2, 2, 5, 5), image.NewUniform(red), image.Point{}, draw.Src)
+	after.SetRGBA(18, 8, black)
+	// under the threshold
+	after.SetRGBA(10, 0, color.RGBA{R: 250, G: 250, B: 250, A: 255})
+
+	result, err := Diff(encodePNG(t, before), encodePNG(t, after), 10)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+
+	if result.Width != 20 || result.Height != 10 || result.TotalPixels != 200 {
+		t.Errorf("size = %dx%d, %d pixels", result.Width, result.Height, result.TotalPixels)
+	}
+	if result.ChangedPixels != 10 || result.ChangedPercent != 5 {
+		t.Errorf("changed %d pixels, %v%%, want 10, 5%%", result.ChangedPixels, result.ChangedPercent)
+	}
+	want := []image.Rectangle{image.Rect(2, 2, 5, 5), image.Rect(18, 8, 19, 9)}
+	if !slices.Equal(result.Regions, want) {
+		t.Errorf("Regions = %v, want %v", result.Regions, want)
+	}
+
+	// changes are red on the after image faded to gray
+	out := decode(t, result.Image)
+	for _, tt := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{3, 3, red},
+		{18, 8, red},
+		// unchanged pixels are taken from the after image
+		{10, 0, color.RGBA{R: 253, G: 253, B: 253, A: 255}},
+		{5, 5, white},
+		{0, 9, color.RGBA{R: 170, G: 170, B: 170, A: 255}},
+	} {
+		if got := color.RGBAModel.Convert(out.At(tt.x, tt.y)); got != tt.want {
+			t.Errorf("pixel %d,%d = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestDiffSizes(t *testing.T) {
+	result, err := Diff(encodePNG(t, filled(4, 4, white)), encodePNG(t, filled(6, 3, white)), 0)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+
+	// the union is compared, pixels in only one image changed
+	if result.Width != 6 || result.Height != 4 || result.ChangedPixels != 6+4 {
+		t.Errorf("%dx%d with %d changed pixels, want 6x4 with 10", result.Width, result.Height, result.ChangedPixels)
+	}
+	if out := decode(t, result.Image).Bounds(); out.Dx() != 6 || out.Dy() != 4 {
+		t.Errorf("diff image is %v", out)
+	}
+	// both strips fall into one grid cell
+	if !slices.Equal(result.Regions, []image.Rectangle{image.Rect(0, 0, 6, 4)}) {
+		t.Errorf("Regions = %v", result.Regions)
+	}
+}
+
+func TestDiffRejectsInvalidImages(t *testing.T) {
+	valid := encodePNG(t, filled(1, 1, white))
+	if _, err := Diff([]byte("not an image"), valid, 0); err == nil {
+		t.Errorf("Diff accepted an invalid before image")
+	}
+	if _, err := Diff(valid, []byte("not an image"), 0); err == nil {
+		t.Errorf("Diff accepted an invalid after image")
+	}
+}
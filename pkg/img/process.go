@@ -0,0 +1,207 @@
+package img
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/sunshineplan/imgconv"
+)
+
+// edgeTolerance is the per channel difference (0-255) under which a pixel counts as background.
+const edgeTolerance = 8
+
+// ProcessOptions describe the post-processing of a capture. The zero value keeps the image as is.
+type ProcessOptions struct {
+	// JPEG encodes the result as JPEG with Quality instead of PNG, flattened onto Background.
+	JPEG    bool
+	Quality int
+	// Width scales the result, padding included, to this many pixels keeping the aspect ratio.
+	Width int
+	// Padding adds this many pixels on every side.
+	Padding int
+	// Background fills the padding; the color of the image edge is used when nil.
+	Background color.Color
+	// Transparent clears the background connected to the image edges.
+	Transparent bool
+	// Trim crops borders of the edge color.
+	Trim bool
+}
+
+// Process applies the options to an encoded image and returns it as PNG or JPEG.
+func Process(data []byte, opts ProcessOptions) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", err)
+	}
+
+	m := image.NewNRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(m, m.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	edge := m.NRGBAAt(0, 0)
+
+	if opts.Trim {
+		m = trim(m, edge)
+	}
+
+	if opts.Transparent {
+		clearBackground(m, edge)
+	}
+
+	if opts.Padding > 0 {
+		background := opts.Background
+		if background == nil {
+			background = edge
+			if opts.Transparent {
+				background = color.Transparent
+			}
+		}
+		m = pad(m, opts.Padding, background)
+	}
+
+	var out image.Image = m
+	if opts.Width > 0 && opts.Width != m.Bounds().Dx() {
+		out = imgconv.Resize(m, &imgconv.ResizeOption{Width: opts.Width})
+	}
+
+	var buf bytes.Buffer
+	if opts.JPEG {
+		background := opts.Background
+		if background == nil {
+			background = color.White
+		}
+
+		flat := image.NewRGBA(out.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), out, out.Bounds().Min, draw.Over)
+
+		quality := opts.Quality
+		if quality == 0 {
+			quality = 90
+		}
+		if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("error encoding JPEG: %v", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, fmt.Errorf("error encoding PNG: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseColor reads a color as #rgb, #rrggbb or #rrggbbaa, with or without the hash.
+func ParseColor(s string) (color.Color, error) {
+	if len(s) > 0 && s[0] == '#' {
+		s = s[1:]
+	}
+
+	var r, g, b, a uint8 = 0, 0, 0, 255
+	var err error
+	switch len(s) {
+	case 3:
+		_, err = fmt.Sscanf(s, "%1x%1x%1x", &r, &g, &b)
+		r, g, b = r*17, g*17, b*17
+	case 6:
+		_, err = fmt.Sscanf(s, "%2x%2x%2x", &r, &g, &b)
+	case 8:
+		_, err = fmt.Sscanf(s, "%2x%2x%2x%2x", &r, &g, &b, &a)
+	default:
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+
+	return color.NRGBA{R: r, G: g, B: b, A: a}, nil
+}
+
+func similar(a, b color.NRGBA) bool {
+	return absDiff(uint16(a.R), uint16(b.R)) <= edgeTolerance &&
+		absDiff(uint16(a.G), uint16(b.G)) <= edgeTolerance &&
+		absDiff(uint16(a.B), uint16(b.B)) <= edgeTolerance &&
+		absDiff(uint16(a.A), uint16(b.A)) <= edgeTolerance
+}
+
+// trim crops the rows and columns on the outside that only contain the edge color.
+func trim(m *image.NRGBA, edge color.NRGBA) *image.NRGBA {
+	b := m.Bounds()
+	content := image.Rectangle{}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !similar(m.NRGBAAt(x, y), edge) {
+				content = content.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	// an image of a single color has nothing to trim to
+	if content.Empty() {
+		return m
+	}
+
+	cropped := image.NewNRGBA(image.Rect(0, 0, content.Dx(), content.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), m, content.Min, draw.Src)
+	return cropped
+}
+
+// clearBackground makes the pixels of the edge color that are connected to the border transparent,
+// leaving the same color inside the content untouched.
+func clearBackground(m *image.NRGBA, edge color.NRGBA) {
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	seen := make([]bool, w*h)
+	var stack []int
+
+	push := func(x, y int) {
+		i := y*w + x
+		if seen[i] || !similar(m.NRGBAAt(x, y), edge) {
+			return
+		}
+		seen[i] = true
+		stack = append(stack, i)
+	}
+
+	for x := 0; x < w; x++ {
+		push(x, 0)
+		push(x, h-1)
+	}
+	for y := 0; y < h; y++ {
+		push(0, y)
+		push(w-1, y)
+	}
+
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%w, i/w
+		m.SetNRGBA(x, y, color.NRGBA{})
+
+		if x > 0 {
+			push(x-1, y)
+		}
+		if x < w-1 {
+			push(x+1, y)
+		}
+		if y > 0 {
+			push(x, y-1)
+		}
+		if y < h-1 {
+			push(x, y+1)
+		}
+	}
+}
+
+func pad(m *image.NRGBA, padding int, background color.Color) *image.NRGBA {
+	b := m.Bounds()
+	padded := image.NewNRGBA(image.Rect(0, 0, b.Dx()+2*padding, b.Dy()+2*padding))
+	draw.Draw(padded, padded.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(padded, image.Rect(padding, padding, padding+b.Dx(), padding+b.Dy()), m, b.Min, draw.Src)
+	return padded
+}
@@ -0,0 +1,113 @@
+package img
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func nrgbaAt(m image.Image, x, y int) color.NRGBA {
+	return color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+}
+
+func TestProcess(t *testing.T) {
+	// a black frame on white, with white inside the frame
+	src := filled(10, 8, white)
+	draw.Draw(src, image.Rect(3, 2, 7, 6), image.NewUniform(black), image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(4, 3, 6, 5), image.NewUniform(white), image.Point{}, draw.Src)
+	data := encodePNG(t, src)
+
+	blue := color.NRGBA{B: 255, A: 255}
+	opaqueWhite := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	opaqueBlack := color.NRGBA{A: 255}
+
+	tests := []struct {
+		name          string
+		opts          ProcessOptions
+		width, height int
+		pixels        map[image.Point]color.NRGBA
+	}{
+		{"unchanged", ProcessOptions{}, 10, 8, map[image.Point]color.NRGBA{{0, 0}: opaqueWhite, {3, 2}: opaqueBlack}},
+		{"trim", ProcessOptions{Trim: true}, 4, 4, map[image.Point]color.NRGBA{{0, 0}: opaqueBlack, {1, 1}: opaqueWhite}},
+		{"transparent", ProcessOptions{Transparent: true}, 10, 8, map[image.Point]color.NRGBA{
+			{0, 0}: {}, {9, 7}: {}, {3, 2}: opaqueBlack,
+			// the white inside the frame is not connected to the border
+			{4, 3}: opaqueWhite,
+		}},
+		{"padding in the edge color", ProcessOptions{Trim: true, Padding: 2}, 8, 8, map[image.Point]color.NRGBA{{0, 0}: opaqueWhite, {2, 2}: opaqueBlack}},
+		{"padding in a background", ProcessOptions{Padding: 1, Background: blue}, 12, 10, map[image.Point]color.NRGBA{{0, 0}: blue, {1, 1}: opaqueWhite}},
+		{"transparent padding", ProcessOptions{Transparent: true, Padding: 1}, 12, 10, map[image.Point]color.NRGBA{{0, 0}: {}, {4, 3}: opaqueBlack}},
+		{"width", ProcessOptions{Width: 20}, 20, 16, map[image.Point]color.NRGBA{{0, 0}: opaqueWhite}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Process(data, tt.opts)
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			m := decode(t, out)
+			if b := m.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+				t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.width, tt.height)
+			}
+			for p, want := range tt.pixels {
+				if got := nrgbaAt(m, p.X, p.Y); got != want {
+					t.Errorf("pixel %v = %v, want %v", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessJPEG(t *testing.T) {
+	// a transparent image is flattened onto the background
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(src, image.Rect(0, 0, 8, 16), image.NewUniform(black), image.Point{}, draw.Src)
+
+	out, err := Process(encodePNG(t, src), ProcessOptions{JPEG: true, Quality: 100, Background: red})
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+
+	m, format, err := image.Decode(bytes.NewReader(out))
+	if err != nil || format != "jpeg" {
+		t.Fatalf("decoded %s, %v, want jpeg", format, err)
+	}
+	if b := m.Bounds(); b.Dx() != 16 || b.Dy() != 16 {
+		t.Errorf("size = %v", b)
+	}
+
+	// JPEG is lossy, so the colors are compared with a tolerance
+	for _, tt := range []struct {
+		x, y int
+		want color.NRGBA
+	}{
+		{2, 8, color.NRGBA{A: 255}},
+		{13, 8, color.NRGBA{R: 255, A: 255}},
+	} {
+		if got := nrgbaAt(m, tt.x, tt.y); absDiff(uint16(got.R), uint16(tt.want.R)) > 16 || got.G > 16 || got.B > 16 {
+			t.Errorf("pixel %d,%d = %v, want about %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := map[string]color.NRGBA{
+		"#fff":      {R: 255, G: 255, B: 255, A: 255},
+		"1a2b3c":    {R: 0x1a, G: 0x2b, B: 0x3c, A: 255},
+		"#00000080": {A: 0x80},
+	}
+	for input, want := range tests {
+		if got, err := ParseColor(input); err != nil || got != want {
+			t.Errorf("ParseColor(%s) = %v, %v, want %v", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", "#ff", "#ggg", "12345"} {
+		if _, err := ParseColor(input); err == nil {
+			t.Errorf("ParseColor(%q) accepted an invalid color", input)
+		}
+	}
+}
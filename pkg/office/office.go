@@ -0,0 +1,323 @@
+package office
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTimeout is returned when LibreOffice did not finish a conversion in time and was killed.
+	ErrTimeout = errors.New("conversion timed out")
+	// ErrBusy is returned when no worker became free within the queue timeout.
+	ErrBusy = errors.New("no office worker available")
+)
+
+// outputFilters maps output formats to the LibreOffice export filters, pdf is picked by extension.
+var outputFilters = map[string]string{
+	"pdf":  "",
+	"pptx": "Impress MS PowerPoint 2007 XML",
+	"docx": "MS Word 2007 XML",
+}
+
+// conversions lists the supported output formats per input format.
+var conversions = map[string][]string{
+	"docx": {"pdf", "docx"},
+	"xlsx": {"pdf"},
+	"pptx": {"pdf", "pptx"},
+	"odp":  {"pdf", "pptx"},
+}
+
+var ContentTypes = map[string]string{
+	"pdf":  "application/pdf",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+}
+
+// Options configures a Converter.
+type Options struct {
+	// Binary is the soffice executable, "soffice" by default.
+	Binary string
+	// Unoserver and Unoconvert are the unoserver executables, found on PATH by default.
+	Unoserver  string
+	Unoconvert string
+	// BasePort is the first of the two local ports every worker listens on, 2003 by default.
+	BasePort int
+	// Workers is the number of conversions that may run at the same time.
+	Workers int
+	// Timeout bounds a single conversion; the worker's LibreOffice is restarted when it runs out.
+	Timeout time.Duration
+	// QueueTimeout bounds the wait for a free worker, 30 seconds by default.
+	QueueTimeout time.Duration
+	// ProfileRoot is where the per-worker user profiles are created, a temp dir by default.
+	ProfileRoot string
+}
+
+// Converter runs conversions on a fixed pool of workers. Every worker keeps one LibreOffice
+// running behind unoserver with its own user profile, so a conversion only pays for loading and
+// exporting the document instead of starting an instance per call.
+type Converter struct {
+	opts    Options
+	workers chan *worker
+}
+
+type worker struct {
+	id         int
+	profileDir string
+	port       int
+	unoPort    int
+	// stop kills the listener's process group, exited is closed once it is gone
+	stop   context.CancelFunc
+	exited chan struct{}
+}
+
+// NewConverter creates the worker profiles and starts their listeners in the background.
+func NewConverter(opts Options) (*Converter, error) {
+	if opts.Binary == "" {
+		opts.Binary = "soffice"
+	}
+	if opts.Unoserver == "" {
+		opts.Unoserver = "unoserver"
+	}
+	if opts.Unoconvert == "" {
+		opts.Unoconvert = "unoconvert"
+	}
+	if opts.BasePort <= 0 {
+		opts.BasePort = 2003
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Minute
+	}
+	if opts.QueueTimeout <= 0 {
+		opts.QueueTimeout = 30 * time.Second
+	}
+	if opts.ProfileRoot == "" {
+		root, err := os.MkdirTemp("", "office-profiles-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create profile directory: %w", err)
+		}
+		opts.ProfileRoot = root
+	}
+
+	c := &Converter{
+		opts:    opts,
+		workers: make(chan *worker, opts.Workers),
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		w := &worker{
+			id:         i,
+			profileDir: filepath.Join(opts.ProfileRoot, fmt.Sprintf("worker-%d", i)),
+			port:       opts.BasePort + 2*i,
+			unoPort:    opts.BasePort + 2*i + 1,
+		}
+		if err := os.MkdirAll(w.profileDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create profile directory: %w", err)
+		}
+		c.workers <- w
+	}
+
+	go c.warmUp()
+
+	return c, nil
+}
+
+// Supported reports whether input can be converted to output.
+func Supported(input, output string) bool {
+	for _, out := range conversions[strings.ToLower(input)] {
+		if out == strings.ToLower(output) {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert converts a document between formats, e.g. "pptx" to "pdf". It waits for a free worker
+// until ctx is done or the queue timeout passes, whichever comes first.
+func (c *Converter) Convert(ctx context.Context, input []byte, inFormat, outFormat string) ([]byte, error) {
+	inFormat, outFormat = strings.ToLower(inFormat), strings.ToLower(outFormat)
+	if !Supported(inFormat, outFormat) {
+		return nil, fmt.Errorf("unsupported conversion: %s to %s", inFormat, outFormat)
+	}
+
+	queue := time.NewTimer(c.opts.QueueTimeout)
+	defer queue.Stop()
+
+	var w *worker
+	select {
+	case w = <-c.workers:
+	case <-queue.C:
+		return nil, fmt.Errorf("%w after waiting %s", ErrBusy, c.opts.QueueTimeout)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %w", ErrBusy, ctx.Err())
+	}
+	defer func() { c.workers <- w }()
+
+	if err := c.ensureRunning(w); err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "office-convert-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	inputPath := filepath.Join(tempDir, "input."+inFormat)
+	outputPath := filepath.Join(tempDir, "output."+outFormat)
+	if err := os.WriteFile(inputPath, input, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write input document: %w", err)
+	}
+
+	args := []string{"--host", "127.0.0.1", "--port", strconv.Itoa(w.port), "--convert-to", outFormat}
+	if filter := outputFilters[outFormat]; filter != "" {
+		args = append(args, "--filter", filter)
+	}
+	args = append(args, inputPath, outputPath)
+
+	if err := c.run(ctx, w, args...); err != nil {
+		return nil, err
+	}
+
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("libreoffice produced no output: %w", err)
+	}
+
+	return output, nil
+}
+
+// Close stops the listeners and removes the worker profiles. It waits for running conversions to finish.
+func (c *Converter) Close() error {
+	for i := 0; i < c.opts.Workers; i++ {
+		c.stopWorker(<-c.workers)
+	}
+	return os.RemoveAll(c.opts.ProfileRoot)
+}
+
+// run sends one conversion to the worker's listener.
+func (c *Converter) run(ctx context.Context, w *worker, args ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.opts.Unoconvert, args...)
+	cmd.WaitDelay = 5 * time.Second
+
+	var stderr bytes.Buffer
+	cmd.Stdout = &stderr
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		// the listener is still busy with the document, and a killed instance can leave a
+		// locked or half-written profile behind
+		c.stopWorker(w)
+		c.resetProfile(w)
+		return fmt.Errorf("%w after %s on worker %d", ErrTimeout, c.opts.Timeout, w.id)
+	}
+	if err != nil {
+		return fmt.Errorf("libreoffice error: %v, details: %s", err, stderr.String())
+	}
+
+	return nil
+}
+
+// ensureRunning starts the worker's listener if it is not running and waits until it accepts
+// connections.
+func (c *Converter) ensureRunning(w *worker) error {
+	if w.exited != nil {
+		select {
+		case <-w.exited:
+			log.Printf("Office worker %d listener exited, restarting it", w.id)
+		default:
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, c.opts.Unoserver,
+		"--interface", "127.0.0.1",
+		"--port", strconv.Itoa(w.port),
+		"--uno-port", strconv.Itoa(w.unoPort),
+		"--executable", c.opts.Binary,
+		"--user-installation", "file://"+filepath.ToSlash(w.profileDir),
+	)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = 5 * time.Second
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return fmt.Errorf("could not start office worker %d: %w", w.id, err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	w.stop, w.exited = cancel, exited
+
+	deadline := time.Now().Add(c.opts.Timeout)
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(w.port))
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			return fmt.Errorf("office worker %d exited on startup: %s", w.id, output.String())
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		if conn, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+			conn.Close()
+			return nil
+		}
+	}
+
+	c.stopWorker(w)
+	return fmt.Errorf("%w: office worker %d did not start within %s", ErrTimeout, w.id, c.opts.Timeout)
+}
+
+// stopWorker kills the worker's listener together with its LibreOffice and waits for it to exit.
+func (c *Converter) stopWorker(w *worker) {
+	if w.stop == nil {
+		return
+	}
+	w.stop()
+	<-w.exited
+	w.stop = nil
+}
+
+// warmUp starts every worker's listener so LibreOffice is running before the first request.
+func (c *Converter) warmUp() {
+	for i := 0; i < c.opts.Workers; i++ {
+		w := <-c.workers
+		if err := c.ensureRunning(w); err != nil {
+			log.Printf("Office worker %d warm-up failed: %v", w.id, err)
+		}
+		c.workers <- w
+	}
+}
+
+func (c *Converter) resetProfile(w *worker) {
+	if err := os.RemoveAll(w.profileDir); err != nil {
+		log.Printf("Failed to reset office worker %d profile: %v", w.id, err)
+	}
+	if err := os.MkdirAll(w.profileDir, 0755); err != nil {
+		log.Printf("Failed to recreate office worker %d profile: %v", w.id, err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package office
+
+import "os/exec"
+
+// killProcessGroup falls back to killing only the direct child where process groups are unavailable.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package office
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup makes cancellation kill unoserver together with the LibreOffice processes it spawns.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,94 @@
+package pptx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const contentTypesPart = "[Content_Types].xml"
+
+// ContentTypes is the content of [Content_Types].xml.
+type ContentTypes struct {
+	XMLName   xml.Name          `xml:"http://schemas.openxmlformats.org/package/2006/content-types Types"`
+	Defaults  []ContentDefault  `xml:"Default"`
+	Overrides []ContentOverride `xml:"Override"`
+}
+
+// ContentDefault maps a file extension to a content type.
+type ContentDefault struct {
+	Extension   string `xml:"Extension,attr"`
+	ContentType string `xml:"ContentType,attr"`
+}
+
+// ContentOverride maps a single part to a content type.
+type ContentOverride struct {
+	PartName    string `xml:"PartName,attr"`
+	ContentType string `xml:"ContentType,attr"`
+}
+
+// ContentTypes parses [Content_Types].xml.
+func (p *Package) ContentTypes() (*ContentTypes, error) {
+	data, _ := p.Part(contentTypesPart)
+
+	ct := &ContentTypes{}
+	if err := xml.Unmarshal(data, ct); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", contentTypesPart, err)
+	}
+
+	return ct, nil
+}
+
+// SetContentTypes writes [Content_Types].xml.
+func (p *Package) SetContentTypes(ct *ContentTypes) error {
+	out, err := xml.Marshal(ct)
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", contentTypesPart, err)
+	}
+
+	p.SetPart(contentTypesPart, append([]byte(xml.Header), out...))
+	return nil
+}
+
+// Lookup returns the content type of a part, preferring overrides over extension defaults.
+func (ct *ContentTypes) Lookup(part string) string {
+	partName := "/" + normalizePart(part)
+	for _, o := range ct.Overrides {
+		if strings.EqualFold(o.PartName, partName) {
+			return o.ContentType
+		}
+	}
+
+	ext := strings.TrimPrefix(path.Ext(partName), ".")
+	for _, d := range ct.Defaults {
+		if strings.EqualFold(d.Extension, ext) {
+			return d.ContentType
+		}
+	}
+
+	return ""
+}
+
+// EnsureDefault registers a content type for an extension if none is registered yet.
+func (ct *ContentTypes) EnsureDefault(ext, contentType string) {
+	ext = strings.TrimPrefix(ext, ".")
+	for _, d := range ct.Defaults {
+		if strings.EqualFold(d.Extension, ext) {
+			return
+		}
+	}
+	ct.Defaults = append(ct.Defaults, ContentDefault{Extension: ext, ContentType: contentType})
+}
+
+// SetOverride registers or replaces the content type of a single part.
+func (ct *ContentTypes) SetOverride(part, contentType string) {
+	partName := "/" + normalizePart(part)
+	for i, o := range ct.Overrides {
+		if strings.EqualFold(o.PartName, partName) {
+			ct.Overrides[i].ContentType = contentType
+			return
+		}
+	}
+	ct.Overrides = append(ct.Overrides, ContentOverride{PartName: partName, ContentType: contentType})
+}
@@ -0,0 +1,186 @@
+package pptx
+
+import (
+	"path"
+	"strings"
+)
+
+// Inspection summarizes the contents of a PPTX file.
+type Inspection struct {
+	SlideCount     int         `json:"slide_count"`
+	Slides         []SlideInfo `json:"slides"`
+	Media          []MediaInfo `json:"media"`
+	EmbeddedVideos int         `json:"embedded_videos"`
+	ExternalVideos int         `json:"external_videos"`
+	MissingVideos  int         `json:"missing_videos"`
+}
+
+// SlideInfo describes a single slide.
+type SlideInfo struct {
+	Index  int         `json:"index"`
+	Part   string      `json:"part"`
+	Title  string      `json:"title"`
+	Text   []string    `json:"text"`
+	Notes  string      `json:"notes"`
+	Media  []MediaInfo `json:"media"`
+	Videos []VideoInfo `json:"videos"`
+	Links  []string    `json:"links"`
+}
+
+// mediaRelTypes are the relationships through which a slide references media parts.
+var mediaRelTypes = map[string]bool{
+	RelTypeImage: true,
+	RelTypeVideo: true,
+	RelTypeMedia: true,
+}
+
+// VideoInfo describes a video placed on a slide. Embedded videos point at a media part inside
+// the package, external ones only carry a URL and missing ones point at a part the package lacks.
+type VideoInfo struct {
+	Name     string `json:"name"`
+	Target   string `json:"target"`
+	External bool   `json:"external"`
+	Embedded bool   `json:"embedded"`
+	Missing  bool   `json:"missing"`
+}
+
+// MediaInfo describes a media part referenced by a slide.
+type MediaInfo struct {
+	Part        string `json:"part"`
+	Size        int    `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+// Inspect reads slides, notes, videos and media of a PPTX file.
+func Inspect(data []byte) (*Inspection, error) {
+	pkg, err := Open(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkg.Inspect()
+}
+
+// Inspect reads slides, notes, videos and media of the package. Media are the parts the slides'
+// relationships point at, each listed once at the top level.
+func (p *Package) Inspect() (*Inspection, error) {
+	slides, err := p.Slides()
+	if err != nil {
+		return nil, err
+	}
+
+	ct, err := p.ContentTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Inspection{
+		SlideCount: len(slides),
+		Slides:     make([]SlideInfo, 0, len(slides)),
+		Media:      []MediaInfo{},
+	}
+	seenMedia := map[string]bool{}
+
+	for _, slide := range slides {
+		rels, err := p.Rels(slide.Part)
+		if err != nil {
+			return nil, err
+		}
+
+		notes, err := p.NotesText(slide.Part)
+		if err != nil {
+			return nil, err
+		}
+
+		info := SlideInfo{
+			Index:  slide.Index,
+			Part:   slide.Part,
+			Title:  slide.Title,
+			Text:   slide.Text,
+			Notes:  notes,
+			Media:  []MediaInfo{},
+			Videos: []VideoInfo{},
+			Links:  []string{},
+		}
+		if info.Text == nil {
+			info.Text = []string{}
+		}
+
+		// a video is referenced twice, as a:videoFile and p14:media, so parts are deduped per slide
+		slideMedia := map[string]bool{}
+		for _, rel := range rels.Relationships {
+			if !mediaRelTypes[rel.Type] || rel.External() {
+				continue
+			}
+			part := ResolveTarget(slide.Part, rel.Target)
+			data, ok := p.Part(part)
+			if !ok || slideMedia[part] {
+				continue
+			}
+			slideMedia[part] = true
+
+			media := MediaInfo{Part: part, Size: len(data), ContentType: mediaContentType(ct, part)}
+			info.Media = append(info.Media, media)
+			if !seenMedia[part] {
+				seenMedia[part] = true
+				result.Media = append(result.Media, media)
+			}
+		}
+
+		for _, pic := range slide.Pictures {
+			if pic.HyperlinkRelID != "" {
+				if rel, ok := rels.ByID(pic.HyperlinkRelID); ok && rel.External() {
+					info.Links = append(info.Links, rel.Target)
+				}
+			}
+
+			if pic.VideoRelID == "" {
+				continue
+			}
+
+			rel, ok := rels.ByID(pic.VideoRelID)
+			if !ok {
+				continue
+			}
+
+			video := VideoInfo{Name: pic.Name, Target: rel.Target, External: rel.External()}
+			if !video.External {
+				video.Target = ResolveTarget(slide.Part, rel.Target)
+				_, video.Embedded = p.Part(video.Target)
+				video.Missing = !video.Embedded
+			}
+
+			switch {
+			case video.Embedded:
+				result.EmbeddedVideos++
+			case video.Missing:
+				result.MissingVideos++
+			default:
+				result.ExternalVideos++
+			}
+
+			info.Videos = append(info.Videos, video)
+		}
+
+		result.Slides = append(result.Slides, info)
+	}
+
+	return result, nil
+}
+
+func mediaContentType(ct *ContentTypes, part string) string {
+	if contentType := ct.Lookup(part); contentType != "" {
+		return contentType
+	}
+
+	switch strings.ToLower(path.Ext(part)) {
+	case ".mp4":
+		return "video/mp4"
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	}
+
+	return "application/octet-stream"
+}
@@ -0,0 +1,77 @@
+package pptx
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	result, err := openDeck(t, "videos").Inspect()
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+
+	if result.SlideCount != 3 || len(result.Slides) != 3 {
+		t.Fatalf("SlideCount = %d with %d slides, want 3", result.SlideCount, len(result.Slides))
+	}
+
+	first := result.Slides[0]
+	if first.Title != "Campaign videos" {
+		t.Errorf("Title = %q", first.Title)
+	}
+	if !slices.Equal(first.Text, []string{"First line\nsecond line"}) {
+		t.Errorf("Text = %q", first.Text)
+	}
+	if first.Notes != "Play both clips" {
+		t.Errorf("Notes = %q", first.Notes)
+	}
+	if !slices.Equal(first.Links, []string{"https://cdn.example.com/clip.mp4", "https://cdn.example.com/clip.mp4"}) {
+		t.Errorf("Links = %v", first.Links)
+	}
+
+	// media come from each slide's relationships, a video referenced twice is listed once
+	wantMedia := [][]string{
+		{"ppt/media/image1.png"},
+		{"ppt/media/image1.png", "ppt/media/media1.mp4"},
+		{},
+	}
+	for i, slide := range result.Slides {
+		if got := mediaParts(slide.Media); !slices.Equal(got, wantMedia[i]) {
+			t.Errorf("slide %d media = %v, want %v", slide.Index, got, wantMedia[i])
+		}
+	}
+
+	// the orphaned part is left out
+	if got := mediaParts(result.Media); !slices.Equal(got, []string{"ppt/media/image1.png", "ppt/media/media1.mp4"}) {
+		t.Errorf("Media = %v", got)
+	}
+	if video := result.Media[1]; video.ContentType != "video/mp4" || video.Size != 17 {
+		t.Errorf("video media = %+v", video)
+	}
+
+	if result.EmbeddedVideos != 1 || result.ExternalVideos != 1 || result.MissingVideos != 1 {
+		t.Errorf("videos: %d embedded, %d external, %d missing, want 1 each",
+			result.EmbeddedVideos, result.ExternalVideos, result.MissingVideos)
+	}
+
+	external := first.Videos[0]
+	if !external.External || external.Embedded || external.Missing || external.Target != "https://cdn.example.com/stream" {
+		t.Errorf("external video = %+v", external)
+	}
+
+	embedded, broken := result.Slides[1].Videos[0], result.Slides[1].Videos[1]
+	if !embedded.Embedded || embedded.External || embedded.Target != "ppt/media/media1.mp4" {
+		t.Errorf("embedded video = %+v", embedded)
+	}
+	if !broken.Missing || broken.External || broken.Embedded || broken.Target != "ppt/media/missing.mp4" {
+		t.Errorf("missing video = %+v", broken)
+	}
+}
+
+func mediaParts(media []MediaInfo) []string {
+	parts := []string{}
+	for _, m := range media {
+		parts = append(parts, m.Part)
+	}
+	return parts
+}
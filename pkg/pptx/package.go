@@ -0,0 +1,115 @@
+package pptx
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Package is an in-memory OOXML package (a .pptx zip) whose parts can be read and replaced.
+type Package struct {
+	parts map[string][]byte
+	order []string
+	// media indexes the media parts added by addMedia by the hash of their content
+	media map[[sha256.Size]byte]string
+}
+
+// Open reads a PPTX file into memory.
+func Open(data []byte) (*Package, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("could not open pptx: %w", err)
+	}
+
+	pkg := &Package{parts: make(map[string][]byte)}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("could not open part %s: %w", f.Name, err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read part %s: %w", f.Name, err)
+		}
+
+		pkg.SetPart(f.Name, b)
+	}
+
+	if _, ok := pkg.parts[contentTypesPart]; !ok {
+		return nil, fmt.Errorf("not an OOXML package: missing %s", contentTypesPart)
+	}
+
+	return pkg, nil
+}
+
+// Part returns the content of the named part, e.g. "ppt/slides/slide1.xml".
+func (p *Package) Part(name string) ([]byte, bool) {
+	b, ok := p.parts[normalizePart(name)]
+	return b, ok
+}
+
+// SetPart adds or replaces a part.
+func (p *Package) SetPart(name string, data []byte) {
+	name = normalizePart(name)
+	if _, ok := p.parts[name]; !ok {
+		p.order = append(p.order, name)
+	}
+	p.parts[name] = data
+}
+
+// PartNames returns the names of all parts matching the given prefix, sorted.
+func (p *Package) PartNames(prefix string) []string {
+	var names []string
+	for _, name := range p.order {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bytes serializes the package back into a PPTX file.
+func (p *Package) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	// [Content_Types].xml is conventionally the first entry
+	names := append([]string{contentTypesPart}, p.order...)
+	written := make(map[string]bool, len(names))
+
+	for _, name := range names {
+		if written[name] {
+			continue
+		}
+		written[name] = true
+
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return nil, fmt.Errorf("could not create part %s: %w", name, err)
+		}
+		if _, err := w.Write(p.parts[name]); err != nil {
+			return nil, fmt.Errorf("could not write part %s: %w", name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("could not finalize pptx: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func normalizePart(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
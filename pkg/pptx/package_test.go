@@ -0,0 +1,122 @@
+package pptx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openDeck zips the parts under testdata/name into a package.
+func openDeck(t *testing.T, name string) *Package {
+	t.Helper()
+
+	root := filepath.Join("testdata", name)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("zip %s: %v", root, err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip %s: %v", root, err)
+	}
+
+	p, err := Open(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Open(%s): %v", name, err)
+	}
+	return p
+}
+
+// reopen writes the package and opens the result, as a client downloading it would.
+func reopen(t *testing.T, p *Package) *Package {
+	t.Helper()
+
+	data, err := p.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	out, err := Open(data)
+	if err != nil {
+		t.Fatalf("Open of the written package: %v", err)
+	}
+	return out
+}
+
+// mustPart returns a part that has to exist.
+func mustPart(t *testing.T, p *Package, name string) []byte {
+	t.Helper()
+
+	data, ok := p.Part(name)
+	if !ok {
+		t.Fatalf("missing part %s", name)
+	}
+	return data
+}
+
+// mustRels returns the relationships of a part.
+func mustRels(t *testing.T, p *Package, source string) *Relationships {
+	t.Helper()
+
+	rels, err := p.Rels(source)
+	if err != nil {
+		t.Fatalf("Rels(%s): %v", source, err)
+	}
+	return rels
+}
+
+// mustContentTypes returns the parsed [Content_Types].xml.
+func mustContentTypes(t *testing.T, p *Package) *ContentTypes {
+	t.Helper()
+
+	ct, err := p.ContentTypes()
+	if err != nil {
+		t.Fatalf("ContentTypes: %v", err)
+	}
+	return ct
+}
+
+func TestBytesKeepsParts(t *testing.T) {
+	p := openDeck(t, "videos")
+	out := reopen(t, p)
+
+	for _, name := range p.PartNames("") {
+		if got := mustPart(t, out, name); !bytes.Equal(got, mustPart(t, p, name)) {
+			t.Errorf("part %s changed on the way", name)
+		}
+	}
+
+	data, err := out.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	if first := zr.File[0].Name; first != contentTypesPart {
+		t.Errorf("first entry is %s, want %s", first, contentTypesPart)
+	}
+}
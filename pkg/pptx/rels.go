@@ -0,0 +1,150 @@
+package pptx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	nsRelationships = "http://schemas.openxmlformats.org/package/2006/relationships"
+
+	RelTypeSlide      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide"
+	RelTypeNotesSlide = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide"
+	RelTypeImage      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	RelTypeVideo      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/video"
+	RelTypeHyperlink  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink"
+	RelTypeMedia      = "http://schemas.microsoft.com/office/2007/relationships/media"
+
+	TargetModeExternal = "External"
+)
+
+// Relationship is a single entry of a .rels part.
+type Relationship struct {
+	ID         string `xml:"Id,attr"`
+	Type       string `xml:"Type,attr"`
+	Target     string `xml:"Target,attr"`
+	TargetMode string `xml:"TargetMode,attr,omitempty"`
+}
+
+// External reports whether the relationship points outside the package.
+func (r Relationship) External() bool {
+	return r.TargetMode == TargetModeExternal
+}
+
+// Relationships is the content of a .rels part.
+type Relationships struct {
+	XMLName       xml.Name       `xml:"http://schemas.openxmlformats.org/package/2006/relationships Relationships"`
+	Relationships []Relationship `xml:"Relationship"`
+}
+
+// ByID returns the relationship with the given ID.
+func (r *Relationships) ByID(id string) (Relationship, bool) {
+	for _, rel := range r.Relationships {
+		if rel.ID == id {
+			return rel, true
+		}
+	}
+	return Relationship{}, false
+}
+
+// Add appends a relationship with the next free rIdN and returns its ID.
+func (r *Relationships) Add(relType, target, targetMode string) string {
+	used := make(map[string]bool, len(r.Relationships))
+	for _, rel := range r.Relationships {
+		used[rel.ID] = true
+	}
+
+	id := ""
+	for i := len(r.Relationships) + 1; ; i++ {
+		id = fmt.Sprintf("rId%d", i)
+		if !used[id] {
+			break
+		}
+	}
+
+	r.Relationships = append(r.Relationships, Relationship{
+		ID:         id,
+		Type:       relType,
+		Target:     target,
+		TargetMode: targetMode,
+	})
+	return id
+}
+
+// Remove drops the relationship with the given ID.
+func (r *Relationships) Remove(id string) {
+	kept := r.Relationships[:0]
+	for _, rel := range r.Relationships {
+		if rel.ID != id {
+			kept = append(kept, rel)
+		}
+	}
+	r.Relationships = kept
+}
+
+// Rels returns the relationships of the given source part. A missing .rels part yields an empty set.
+func (p *Package) Rels(source string) (*Relationships, error) {
+	rels := &Relationships{}
+
+	data, ok := p.Part(relsPartName(source))
+	if !ok {
+		return rels, nil
+	}
+
+	if err := xml.Unmarshal(data, rels); err != nil {
+		return nil, fmt.Errorf("could not parse relationships of %s: %w", source, err)
+	}
+
+	return rels, nil
+}
+
+// SetRels writes the relationships of the given source part.
+func (p *Package) SetRels(source string, rels *Relationships) error {
+	out, err := xml.Marshal(rels)
+	if err != nil {
+		return fmt.Errorf("could not encode relationships of %s: %w", source, err)
+	}
+
+	p.SetPart(relsPartName(source), append([]byte(xml.Header), out...))
+	return nil
+}
+
+// ResolveTarget turns a relationship target into an absolute part name.
+func ResolveTarget(source, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return normalizePart(target)
+	}
+	return normalizePart(path.Join(path.Dir(source), target))
+}
+
+// RelativeTarget is the inverse of ResolveTarget: the target to use in source's .rels to reach part.
+func RelativeTarget(source, part string) string {
+	var from []string
+	if dir := path.Dir(normalizePart(source)); dir != "." {
+		from = strings.Split(dir, "/")
+	}
+	to := strings.Split(normalizePart(part), "/")
+
+	i := 0
+	for i < len(from) && i < len(to)-1 && from[i] == to[i] {
+		i++
+	}
+
+	var segments []string
+	for range from[i:] {
+		segments = append(segments, "..")
+	}
+	segments = append(segments, to[i:]...)
+
+	return strings.Join(segments, "/")
+}
+
+func relsPartName(source string) string {
+	if source == "" || source == "/" {
+		return "_rels/.rels"
+	}
+	source = normalizePart(source)
+	return path.Join(path.Dir(source), "_rels", path.Base(source)+".rels")
+}
@@ -0,0 +1,293 @@
+package pptx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	nsPresentation   = "http://schemas.openxmlformats.org/presentationml/2006/main"
+	nsDrawing        = "http://schemas.openxmlformats.org/drawingml/2006/main"
+	nsOfficeRels     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	nsPowerPoint14   = "http://schemas.microsoft.com/office/powerpoint/2010/main"
+	relTypeOfficeDoc = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument"
+)
+
+// Slide is the parsed content of a single slide part.
+type Slide struct {
+	Index    int
+	Part     string
+	Title    string
+	Text     []string
+	Pictures []Picture
+}
+
+// Picture is a p:pic element, optionally carrying a hyperlink or a video.
+type Picture struct {
+	ID             string
+	Name           string
+	ImageRelID     string
+	HyperlinkRelID string
+	VideoRelID     string
+	MediaRelID     string
+
+	// byte ranges of the p:pic element and its p:spPr child within the slide part
+	start, end int64
+	spPrStart  int64
+	spPrEnd    int64
+}
+
+// PresentationPart returns the name of the main presentation part.
+func (p *Package) PresentationPart() (string, error) {
+	rels, err := p.Rels("")
+	if err != nil {
+		return "", err
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.Type == relTypeOfficeDoc {
+			return ResolveTarget("", rel.Target), nil
+		}
+	}
+
+	return "", fmt.Errorf("could not find presentation part")
+}
+
+// SlideParts returns the slide part names in presentation order.
+func (p *Package) SlideParts() ([]string, error) {
+	presPart, err := p.PresentationPart()
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := p.Part(presPart)
+	if !ok {
+		return nil, fmt.Errorf("missing presentation part %s", presPart)
+	}
+
+	rels, err := p.Rels(presPart)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []string
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", presPart, err)
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Space != nsPresentation || se.Name.Local != "sldId" {
+			continue
+		}
+
+		rel, ok := rels.ByID(attr(se, nsOfficeRels, "id"))
+		if !ok {
+			continue
+		}
+		parts = append(parts, ResolveTarget(presPart, rel.Target))
+	}
+
+	return parts, nil
+}
+
+// Slides parses every slide in presentation order.
+func (p *Package) Slides() ([]Slide, error) {
+	parts, err := p.SlideParts()
+	if err != nil {
+		return nil, err
+	}
+
+	slides := make([]Slide, 0, len(parts))
+	for i, part := range parts {
+		data, ok := p.Part(part)
+		if !ok {
+			return nil, fmt.Errorf("missing slide part %s", part)
+		}
+
+		slide, err := parseSlide(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", part, err)
+		}
+		slide.Index = i + 1
+		slide.Part = part
+
+		slides = append(slides, *slide)
+	}
+
+	return slides, nil
+}
+
+// parseSlide walks a slide (or notes slide) and collects text, the title placeholder and pictures.
+func parseSlide(data []byte) (*Slide, error) {
+	slide := &Slide{}
+
+	var (
+		placeholder string
+		inShape     bool
+		pic         *Picture
+		paragraph   strings.Builder
+		inParagraph bool
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == nsPresentation && t.Name.Local == "sp":
+				inShape = true
+				placeholder = ""
+			case t.Name.Space == nsPresentation && t.Name.Local == "ph":
+				if inShape {
+					placeholder = attr(t, "", "type")
+				}
+			case t.Name.Space == nsPresentation && t.Name.Local == "pic":
+				pic = &Picture{start: offset}
+			case t.Name.Space == nsPresentation && t.Name.Local == "cNvPr":
+				if pic != nil {
+					pic.ID = attr(t, "", "id")
+					pic.Name = attr(t, "", "name")
+				}
+			case t.Name.Space == nsPresentation && t.Name.Local == "spPr":
+				if pic != nil {
+					pic.spPrStart = offset
+				}
+			case t.Name.Space == nsDrawing && t.Name.Local == "hlinkClick":
+				if pic != nil {
+					pic.HyperlinkRelID = attr(t, nsOfficeRels, "id")
+				}
+			case t.Name.Space == nsDrawing && t.Name.Local == "blip":
+				if pic != nil {
+					pic.ImageRelID = attr(t, nsOfficeRels, "embed")
+				}
+			case t.Name.Space == nsDrawing && t.Name.Local == "videoFile":
+				if pic != nil {
+					pic.VideoRelID = attr(t, nsOfficeRels, "link")
+				}
+			case t.Name.Space == nsPowerPoint14 && t.Name.Local == "media":
+				if pic != nil {
+					pic.MediaRelID = attr(t, nsOfficeRels, "embed")
+				}
+			case t.Name.Space == nsDrawing && t.Name.Local == "p":
+				inParagraph = true
+				paragraph.Reset()
+			case t.Name.Space == nsDrawing && t.Name.Local == "br":
+				if inParagraph {
+					paragraph.WriteString("\n")
+				}
+			}
+
+		case xml.CharData:
+			if inParagraph {
+				paragraph.Write(t)
+			}
+
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == nsPresentation && t.Name.Local == "sp":
+				inShape = false
+				placeholder = ""
+			case t.Name.Space == nsPresentation && t.Name.Local == "spPr":
+				if pic != nil {
+					pic.spPrEnd = dec.InputOffset()
+				}
+			case t.Name.Space == nsPresentation && t.Name.Local == "pic":
+				if pic != nil {
+					pic.end = dec.InputOffset()
+					slide.Pictures = append(slide.Pictures, *pic)
+				}
+				pic = nil
+			case t.Name.Space == nsDrawing && t.Name.Local == "p":
+				inParagraph = false
+				text := strings.TrimSpace(paragraph.String())
+				if text == "" {
+					continue
+				}
+
+				if inShape && (placeholder == "title" || placeholder == "ctrTitle") {
+					if slide.Title != "" {
+						slide.Title += " "
+					}
+					slide.Title += text
+				} else {
+					slide.Text = append(slide.Text, text)
+				}
+			}
+		}
+	}
+
+	return slide, nil
+}
+
+// NotesText returns the speaker notes of a slide, or "" if it has none.
+func (p *Package) NotesText(slidePart string) (string, error) {
+	rels, err := p.Rels(slidePart)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.Type != RelTypeNotesSlide {
+			continue
+		}
+
+		data, ok := p.Part(ResolveTarget(slidePart, rel.Target))
+		if !ok {
+			return "", nil
+		}
+
+		notes, err := parseSlide(data)
+		if err != nil {
+			return "", fmt.Errorf("could not parse notes of %s: %w", slidePart, err)
+		}
+
+		// the notes slide also carries the slide number and a copy of the slide image; the
+		// actual notes live in the body placeholder which parseSlide reports as plain text
+		var lines []string
+		for _, line := range notes.Text {
+			if isDigits(line) {
+				continue
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	return "", nil
+}
+
+func attr(se xml.StartElement, space, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
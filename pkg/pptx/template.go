@@ -0,0 +1,521 @@
+package pptx
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	nsChart = "http://schemas.openxmlformats.org/drawingml/2006/chart"
+
+	RelTypeChart = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// ChartData replaces the cached data of a chart.
+type ChartData struct {
+	Categories []string      `json:"categories"`
+	Series     []ChartSeries `json:"series"`
+}
+
+// ChartSeries is a single named series of a chart.
+type ChartSeries struct {
+	Name   string    `json:"name"`
+	Values []float64 `json:"values"`
+}
+
+// ReplaceText substitutes {{key}} placeholders in every slide, including placeholders that
+// PowerPoint split across several runs. Unknown keys are left untouched.
+func (p *Package) ReplaceText(values map[string]string) error {
+	return p.editSlides(func(part string, root *xmlNode) (bool, error) {
+		changed := false
+		for _, para := range root.Descendants(nsDrawing, "p") {
+			if replaceParagraph(para, values) {
+				changed = true
+			}
+		}
+		return changed, nil
+	})
+}
+
+// ReplaceImage swaps the image of every picture named key or {{key}} (by shape name or alt text)
+// and returns the number of pictures replaced.
+func (p *Package) ReplaceImage(key string, image []byte) (int, error) {
+	ext, contentType := imageExtension(image)
+	if ext == "" {
+		return 0, fmt.Errorf("unsupported image type for %s: %s", key, http.DetectContentType(image))
+	}
+
+	var imagePart string
+	count := 0
+
+	err := p.editSlides(func(part string, root *xmlNode) (bool, error) {
+		var rels *Relationships
+		relID := ""
+
+		for _, pic := range root.Descendants(nsPresentation, "pic") {
+			if !shapeMatches(pic, key) {
+				continue
+			}
+
+			blip := pic.Descendant(nsDrawing, "blip")
+			if blip == nil {
+				continue
+			}
+
+			if imagePart == "" {
+				imagePart = p.nextMediaPart("image", "."+ext)
+				p.SetPart(imagePart, image)
+			}
+
+			if rels == nil {
+				var err error
+				if rels, err = p.Rels(part); err != nil {
+					return false, err
+				}
+				relID = rels.Add(RelTypeImage, RelativeTarget(part, imagePart), "")
+			}
+
+			blip.SetAttr(nsOfficeRels, "embed", relID)
+			count++
+		}
+
+		if rels == nil {
+			return false, nil
+		}
+		return true, p.SetRels(part, rels)
+	})
+	if err != nil || imagePart == "" {
+		return count, err
+	}
+
+	ct, err := p.ContentTypes()
+	if err != nil {
+		return count, err
+	}
+	ct.EnsureDefault(ext, contentType)
+
+	return count, p.SetContentTypes(ct)
+}
+
+// FillTable replaces the rows of every table named key or {{key}}. Each new row copies the
+// formatting of the template row at the same position, or of the last row when the template is shorter.
+func (p *Package) FillTable(key string, rows [][]string) (int, error) {
+	if len(rows) == 0 {
+		return 0, fmt.Errorf("table %s: no rows given", key)
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+
+	count := 0
+	err := p.editSlides(func(part string, root *xmlNode) (bool, error) {
+		changed := false
+		for _, frame := range root.Descendants(nsPresentation, "graphicFrame") {
+			if !shapeMatches(frame, key) {
+				continue
+			}
+
+			tbl := frame.Descendant(nsDrawing, "tbl")
+			if tbl == nil {
+				continue
+			}
+
+			if err := fillTable(tbl, rows, columns); err != nil {
+				return false, fmt.Errorf("table %s on %s: %w", key, part, err)
+			}
+			changed = true
+			count++
+		}
+		return changed, nil
+	})
+
+	return count, err
+}
+
+// FillChart replaces the cached categories and series of every chart named key or {{key}}.
+// The chart's embedded workbook is left as is, so PowerPoint shows the new data until someone
+// edits the data in Excel.
+func (p *Package) FillChart(key string, data ChartData) (int, error) {
+	if len(data.Series) == 0 {
+		return 0, fmt.Errorf("chart %s: no series given", key)
+	}
+
+	count := 0
+	err := p.editSlides(func(part string, root *xmlNode) (bool, error) {
+		rels, err := p.Rels(part)
+		if err != nil {
+			return false, err
+		}
+
+		for _, frame := range root.Descendants(nsPresentation, "graphicFrame") {
+			if !shapeMatches(frame, key) {
+				continue
+			}
+
+			chart := frame.Descendant(nsChart, "chart")
+			if chart == nil {
+				continue
+			}
+
+			rel, ok := rels.ByID(chart.Attr(nsOfficeRels, "id"))
+			if !ok || rel.Type != RelTypeChart {
+				continue
+			}
+
+			chartPart := ResolveTarget(part, rel.Target)
+			if err := p.fillChartPart(chartPart, data); err != nil {
+				return false, fmt.Errorf("chart %s on %s: %w", key, part, err)
+			}
+			count++
+		}
+
+		// the slide itself is unchanged, only the chart parts are rewritten
+		return false, nil
+	})
+
+	return count, err
+}
+
+func (p *Package) fillChartPart(part string, data ChartData) error {
+	raw, ok := p.Part(part)
+	if !ok {
+		return fmt.Errorf("missing chart part %s", part)
+	}
+
+	root, err := parseXMLTree(raw)
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %w", part, err)
+	}
+
+	sers := root.Descendants(nsChart, "ser")
+	if len(sers) == 0 {
+		return fmt.Errorf("%s has no series", part)
+	}
+
+	// all series of the first chart type are replaced, those of any other chart type in a combo
+	// chart are dropped; the emptied plots stay so their axes remain referenced
+	plot := sers[0].Parent
+	template := plot.Elements(nsChart, "ser")
+	for _, ser := range sers {
+		if ser.Parent != plot {
+			ser.Parent.RemoveChildren(nsChart, "ser")
+		}
+	}
+
+	var insertAt int
+	for i, c := range plot.Children {
+		if c == template[0] {
+			insertAt = i
+			break
+		}
+	}
+	plot.RemoveChildren(nsChart, "ser")
+
+	categories := data.Categories
+	var newSers []*xmlNode
+	for i, series := range data.Series {
+		ser := template[min(i, len(template)-1)].Clone()
+		ser.Parent = plot
+
+		if idx := ser.Element(nsChart, "idx"); idx != nil {
+			idx.SetAttr("", "val", strconv.Itoa(i))
+		}
+		if order := ser.Element(nsChart, "order"); order != nil {
+			order.SetAttr("", "val", strconv.Itoa(i))
+		}
+
+		if tx := ser.Element(nsChart, "tx"); tx != nil {
+			if cache := tx.Descendant(nsChart, "strCache"); cache != nil {
+				setChartCache(cache, []string{series.Name})
+			} else if v := tx.Element(nsChart, "v"); v != nil {
+				v.SetText(series.Name)
+			}
+		}
+
+		if cat := ser.Element(nsChart, "cat"); cat != nil && categories != nil {
+			setChartCache(chartCacheOf(cat), categories)
+		}
+
+		if val := ser.Element(nsChart, "val"); val != nil {
+			values := make([]string, len(series.Values))
+			for j, v := range series.Values {
+				values[j] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+			setChartCache(chartCacheOf(val), values)
+		}
+
+		newSers = append(newSers, ser)
+	}
+
+	children := append([]*xmlNode{}, plot.Children[:insertAt]...)
+	children = append(children, newSers...)
+	children = append(children, plot.Children[insertAt:]...)
+	plot.Children = children
+
+	p.SetPart(part, root.Bytes())
+	return nil
+}
+
+// chartCacheOf returns the point container of a c:cat or c:val element: the cache of a reference
+// or the literal itself.
+func chartCacheOf(n *xmlNode) *xmlNode {
+	for _, name := range []string{"strCache", "numCache", "strLit", "numLit"} {
+		if cache := n.Descendant(nsChart, name); cache != nil {
+			return cache
+		}
+	}
+	return nil
+}
+
+func setChartCache(cache *xmlNode, values []string) {
+	if cache == nil {
+		return
+	}
+
+	cache.RemoveChildren(nsChart, "pt")
+
+	ptCount := cache.Element(nsChart, "ptCount")
+	if ptCount == nil {
+		ptCount = cache.AppendChild(cache.NewElement(nsChart, "ptCount"))
+	}
+	ptCount.SetAttr("", "val", strconv.Itoa(len(values)))
+
+	for i, value := range values {
+		pt := cache.AppendChild(cache.NewElement(nsChart, "pt"))
+		pt.SetAttr("", "idx", strconv.Itoa(i))
+		pt.AppendChild(pt.NewElement(nsChart, "v")).SetText(value)
+	}
+
+	// c:extLst has to stay last
+	if ext := cache.Element(nsChart, "extLst"); ext != nil {
+		cache.RemoveChildren(nsChart, "extLst")
+		cache.AppendChild(ext)
+	}
+}
+
+func fillTable(tbl *xmlNode, rows [][]string, columns int) error {
+	trs := tbl.Elements(nsDrawing, "tr")
+	if len(trs) == 0 {
+		return fmt.Errorf("table has no rows")
+	}
+
+	if grid := tbl.Element(nsDrawing, "tblGrid"); grid != nil {
+		cols := grid.Elements(nsDrawing, "gridCol")
+		if len(cols) > 0 && len(cols) != columns {
+			total := 0
+			for _, col := range cols {
+				w, _ := strconv.Atoi(col.Attr("", "w"))
+				total += w
+			}
+
+			grid.RemoveChildren(nsDrawing, "gridCol")
+			for i := 0; i < columns; i++ {
+				col := cols[min(i, len(cols)-1)].Clone()
+				col.SetAttr("", "w", strconv.Itoa(total/columns))
+				grid.AppendChild(col)
+			}
+		}
+	}
+
+	tbl.RemoveChildren(nsDrawing, "tr")
+	for i, row := range rows {
+		tr := trs[min(i, len(trs)-1)].Clone()
+		tcs := tr.Elements(nsDrawing, "tc")
+		if len(tcs) == 0 {
+			return fmt.Errorf("table row has no cells")
+		}
+
+		tr.RemoveChildren(nsDrawing, "tc")
+		for j := 0; j < columns; j++ {
+			tc := tcs[min(j, len(tcs)-1)].Clone()
+			// merged cells of the template would swallow the new ones
+			for _, a := range []string{"gridSpan", "rowSpan", "hMerge", "vMerge"} {
+				removeAttr(tc, a)
+			}
+
+			text := ""
+			if j < len(row) {
+				text = row[j]
+			}
+			setCellText(tc, text)
+			tr.AppendChild(tc)
+		}
+
+		// cells have to come before a trailing a:extLst
+		if ext := tr.Element(nsDrawing, "extLst"); ext != nil {
+			tr.RemoveChildren(nsDrawing, "extLst")
+			tr.AppendChild(ext)
+		}
+
+		tbl.AppendChild(tr)
+	}
+
+	return nil
+}
+
+func setCellText(tc *xmlNode, text string) {
+	body := tc.Element(nsDrawing, "txBody")
+	if body == nil {
+		return
+	}
+
+	paras := body.Elements(nsDrawing, "p")
+	var para *xmlNode
+	if len(paras) > 0 {
+		para = paras[0]
+		body.RemoveChildren(nsDrawing, "p")
+		body.AppendChild(para)
+	} else {
+		para = body.AppendChild(body.NewElement(nsDrawing, "p"))
+	}
+
+	run := para.Element(nsDrawing, "r")
+	if run == nil {
+		run = para.NewElement(nsDrawing, "r")
+	}
+
+	// keep only the first run, which has to come before a:endParaRPr
+	end := para.Element(nsDrawing, "endParaRPr")
+	para.RemoveChildren(nsDrawing, "r")
+	para.RemoveChildren(nsDrawing, "endParaRPr")
+	para.AppendChild(run)
+	if end != nil {
+		para.AppendChild(end)
+	}
+
+	t := run.Element(nsDrawing, "t")
+	if t == nil {
+		t = run.AppendChild(run.NewElement(nsDrawing, "t"))
+	}
+	t.SetText(text)
+}
+
+func removeAttr(n *xmlNode, local string) {
+	kept := n.Attrs[:0]
+	for _, a := range n.Attrs {
+		if a.Prefix != "" || a.Local != local {
+			kept = append(kept, a)
+		}
+	}
+	n.Attrs = kept
+}
+
+// replaceParagraph substitutes placeholders in the a:t nodes of one paragraph. A placeholder that
+// spans several runs is written into the run it starts in and removed from the others, so the
+// replacement takes the formatting of its first character.
+func replaceParagraph(para *xmlNode, values map[string]string) bool {
+	ts := para.Descendants(nsDrawing, "t")
+	if len(ts) == 0 {
+		return false
+	}
+
+	var full strings.Builder
+	var owner []int
+	for i, t := range ts {
+		text := t.InnerText()
+		full.WriteString(text)
+		for range len(text) {
+			owner = append(owner, i)
+		}
+	}
+
+	text := full.String()
+	matches := placeholderPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return false
+	}
+
+	out := make([]strings.Builder, len(ts))
+	changed := false
+	pos := 0
+	for _, m := range matches {
+		value, ok := values[text[m[2]:m[3]]]
+		if !ok {
+			continue
+		}
+
+		for ; pos < m[0]; pos++ {
+			out[owner[pos]].WriteByte(text[pos])
+		}
+		out[owner[m[0]]].WriteString(value)
+		pos = m[1]
+		changed = true
+	}
+	for ; pos < len(text); pos++ {
+		out[owner[pos]].WriteByte(text[pos])
+	}
+
+	if !changed {
+		return false
+	}
+
+	for i, t := range ts {
+		t.SetText(out[i].String())
+	}
+	return true
+}
+
+// shapeMatches reports whether the shape's name or alt text is key or {{key}}.
+func shapeMatches(shape *xmlNode, key string) bool {
+	cNvPr := shape.Descendant(nsPresentation, "cNvPr")
+	if cNvPr == nil {
+		return false
+	}
+
+	for _, v := range []string{cNvPr.Attr("", "name"), cNvPr.Attr("", "descr")} {
+		v = strings.TrimSpace(v)
+		if v == key || v == "{{"+key+"}}" {
+			return true
+		}
+	}
+	return false
+}
+
+// editSlides parses every slide into a tree, passes it to fn and writes it back when fn reports a change.
+func (p *Package) editSlides(fn func(part string, root *xmlNode) (bool, error)) error {
+	parts, err := p.SlideParts()
+	if err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		data, ok := p.Part(part)
+		if !ok {
+			return fmt.Errorf("missing slide part %s", part)
+		}
+
+		root, err := parseXMLTree(data)
+		if err != nil {
+			return fmt.Errorf("could not parse %s: %w", part, err)
+		}
+
+		changed, err := fn(part, root)
+		if err != nil {
+			return err
+		}
+		if changed {
+			p.SetPart(part, root.Bytes())
+		}
+	}
+
+	return nil
+}
+
+func imageExtension(image []byte) (string, string) {
+	switch contentType := http.DetectContentType(image); contentType {
+	case "image/png":
+		return "png", contentType
+	case "image/jpeg":
+		return "jpeg", contentType
+	case "image/gif":
+		return "gif", contentType
+	}
+	return "", ""
+}
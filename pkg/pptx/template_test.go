@@ -0,0 +1,199 @@
+package pptx
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const templateSlide = "ppt/slides/slide1.xml"
+
+func TestReplaceText(t *testing.T) {
+	p := openDeck(t, "template")
+	if err := p.ReplaceText(map[string]string{"username": "alice & bob", "period": "May"}); err != nil {
+		t.Fatalf("ReplaceText: %v", err)
+	}
+
+	slides, err := reopen(t, p).Slides()
+	if err != nil {
+		t.Fatalf("Slides: %v", err)
+	}
+	if slides[0].Title != "Report for alice & bob" {
+		t.Errorf("Title = %q", slides[0].Title)
+	}
+	if len(slides[0].Text) == 0 || slides[0].Text[0] != "May and {{unknown}}" {
+		t.Errorf("Text = %q", slides[0].Text)
+	}
+
+	// a placeholder split across runs takes the formatting of the run it starts in
+	slide := string(mustPart(t, p, templateSlide))
+	if !strings.Contains(slide, `<a:rPr b="1"/><a:t>Report for alice &amp; bob</a:t>`) {
+		t.Errorf("placeholder not written into its first run:\n%s", slide)
+	}
+}
+
+func TestReplaceImage(t *testing.T) {
+	p := openDeck(t, "template")
+	jpeg := []byte("\xff\xd8\xff\xe0 avatar")
+
+	count, err := p.ReplaceImage("avatar", jpeg)
+	if err != nil || count != 1 {
+		t.Fatalf("ReplaceImage = %d, %v, want 1", count, err)
+	}
+	if count, err := p.ReplaceImage("nobody", jpeg); err != nil || count != 0 {
+		t.Errorf("ReplaceImage of an unknown key = %d, %v", count, err)
+	}
+	if _, err := p.ReplaceImage("avatar", []byte("not an image")); err == nil {
+		t.Errorf("ReplaceImage accepted an unknown image type")
+	}
+
+	out := reopen(t, p)
+	if got := mustPart(t, out, "ppt/media/image1.jpeg"); !bytes.Equal(got, jpeg) {
+		t.Errorf("image part = %q", got)
+	}
+	if got := mustContentTypes(t, out).Lookup("ppt/media/image1.jpeg"); got != "image/jpeg" {
+		t.Errorf("content type = %s", got)
+	}
+
+	slides, err := out.Slides()
+	if err != nil {
+		t.Fatalf("Slides: %v", err)
+	}
+	rel, ok := mustRels(t, out, templateSlide).ByID(slides[0].Pictures[0].ImageRelID)
+	if !ok || rel.Type != RelTypeImage || rel.Target != "../media/image1.jpeg" {
+		t.Errorf("image relationship = %+v", rel)
+	}
+}
+
+func TestFillTable(t *testing.T) {
+	p := openDeck(t, "template")
+	rows := [][]string{{"Metric", "Value"}, {"Reach", "1 < 2"}, {"Likes"}}
+
+	count, err := p.FillTable("stats", rows)
+	if err != nil || count != 1 {
+		t.Fatalf("FillTable = %d, %v, want 1", count, err)
+	}
+
+	tbl := slideTree(t, reopen(t, p)).Descendant(nsDrawing, "tbl")
+	trs := tbl.Elements(nsDrawing, "tr")
+	if len(trs) != len(rows) {
+		t.Fatalf("table has %d rows, want %d", len(trs), len(rows))
+	}
+
+	for i, tr := range trs {
+		tcs := tr.Elements(nsDrawing, "tc")
+		if len(tcs) != 2 {
+			t.Fatalf("row %d has %d cells", i, len(tcs))
+		}
+		for j, tc := range tcs {
+			want := ""
+			if j < len(rows[i]) {
+				want = rows[i][j]
+			}
+			if got := tc.InnerText(); got != want {
+				t.Errorf("cell %d,%d = %q, want %q", i, j, got, want)
+			}
+			if tc.Attr("", "gridSpan") != "" || tc.Attr("", "hMerge") != "" {
+				t.Errorf("cell %d,%d kept the template's merge", i, j)
+			}
+			if runs := tc.Descendants(nsDrawing, "r"); len(runs) != 1 {
+				t.Errorf("cell %d,%d has %d runs", i, j, len(runs))
+			}
+		}
+	}
+
+	// the header row keeps its bold runs, the other rows copy the last template row
+	if trs[0].Descendant(nsDrawing, "rPr").Attr("", "b") != "1" {
+		t.Errorf("header row lost its formatting")
+	}
+	if trs[2].Descendant(nsDrawing, "rPr") != nil {
+		t.Errorf("last row took the header's formatting")
+	}
+
+	// a different column count splits the grid evenly
+	if _, err := p.FillTable("stats", [][]string{{"a", "b", "c"}}); err != nil {
+		t.Fatalf("FillTable: %v", err)
+	}
+	cols := slideTree(t, p).Descendant(nsDrawing, "tblGrid").Elements(nsDrawing, "gridCol")
+	if len(cols) != 3 || cols[0].Attr("", "w") != "2000" {
+		t.Errorf("grid has %d columns of %s", len(cols), cols[0].Attr("", "w"))
+	}
+}
+
+func TestFillChart(t *testing.T) {
+	p := openDeck(t, "template")
+	data := ChartData{
+		Categories: []string{"Mar", "Apr", "May"},
+		Series: []ChartSeries{
+			{Name: "Views", Values: []float64{1, 2.5, 3}},
+			{Name: "Shares", Values: []float64{4, 5, 6}},
+			{Name: "Saves", Values: []float64{7, 8, 9}},
+		},
+	}
+
+	count, err := p.FillChart("growth", data)
+	if err != nil || count != 1 {
+		t.Fatalf("FillChart = %d, %v, want 1", count, err)
+	}
+
+	root, err := parseXMLTree(mustPart(t, reopen(t, p), "ppt/charts/chart1.xml"))
+	if err != nil {
+		t.Fatalf("parse chart: %v", err)
+	}
+
+	bar := root.Descendant(nsChart, "barChart")
+	sers := bar.Elements(nsChart, "ser")
+	if len(sers) != len(data.Series) {
+		t.Fatalf("bar chart has %d series, want %d", len(sers), len(data.Series))
+	}
+	for i, ser := range sers {
+		series := data.Series[i]
+		if got := ser.Element(nsChart, "idx").Attr("", "val"); got != strconv.Itoa(i) {
+			t.Errorf("series %d idx = %s", i, got)
+		}
+		if got := cachePoints(ser.Element(nsChart, "tx")); !slices.Equal(got, []string{series.Name}) {
+			t.Errorf("series %d name = %v", i, got)
+		}
+		if got := cachePoints(ser.Element(nsChart, "cat")); !slices.Equal(got, data.Categories) {
+			t.Errorf("series %d categories = %v", i, got)
+		}
+		if got := ser.Element(nsChart, "val").Descendant(nsChart, "ptCount").Attr("", "val"); got != "3" {
+			t.Errorf("series %d ptCount = %s", i, got)
+		}
+	}
+	if got := cachePoints(sers[0].Element(nsChart, "val")); !slices.Equal(got, []string{"1", "2.5", "3"}) {
+		t.Errorf("values = %v", got)
+	}
+
+	// series come before the axis IDs
+	if children := bar.Elements(nsChart, "axId"); len(children) != 2 || bar.Children[len(bar.Children)-1] != children[1] {
+		t.Errorf("axis IDs moved")
+	}
+
+	// the line plot of the combo chart keeps no stale series, but stays with its axes
+	line := root.Descendant(nsChart, "lineChart")
+	if line == nil || len(line.Elements(nsChart, "ser")) != 0 || len(line.Elements(nsChart, "axId")) != 2 {
+		t.Errorf("line plot = %s", line.Bytes())
+	}
+}
+
+func slideTree(t *testing.T, p *Package) *xmlNode {
+	t.Helper()
+
+	root, err := parseXMLTree(mustPart(t, p, templateSlide))
+	if err != nil {
+		t.Fatalf("parse slide: %v", err)
+	}
+	return root
+}
+
+// cachePoints returns the values of the points below a chart element.
+func cachePoints(n *xmlNode) []string {
+	var values []string
+	for _, pt := range n.Descendants(nsChart, "pt") {
+		values = append(values, pt.InnerText())
+	}
+	return values
+}
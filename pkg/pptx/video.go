@@ -0,0 +1,310 @@
+package pptx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// videoExtensions maps the file extensions we treat as linked videos to their content types.
+var videoExtensions = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+}
+
+// videoTypeExtensions maps video content types to the extension their media parts are named with.
+var videoTypeExtensions = map[string]string{
+	"video/mp4":       ".mp4",
+	"video/x-m4v":     ".m4v",
+	"video/quicktime": ".mov",
+	"video/webm":      ".webm",
+	"video/avi":       ".avi",
+	"video/x-msvideo": ".avi",
+	"video/x-ms-wmv":  ".wmv",
+	"video/mpeg":      ".mpg",
+}
+
+// VideoLink is a picture on a slide that points at a video URL instead of embedding it, either
+// through an external a:videoFile link or through a click hyperlink as produced by Google Slides.
+type VideoLink struct {
+	SlidePart string
+	Picture   int
+	Name      string
+	URL       string
+}
+
+// VideoLinks returns every picture whose video still lives outside the package.
+func (p *Package) VideoLinks() ([]VideoLink, error) {
+	slides, err := p.Slides()
+	if err != nil {
+		return nil, err
+	}
+
+	var links []VideoLink
+	for _, slide := range slides {
+		rels, err := p.Rels(slide.Part)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, pic := range slide.Pictures {
+			link := VideoLink{SlidePart: slide.Part, Picture: i, Name: pic.Name}
+
+			if pic.VideoRelID != "" {
+				rel, ok := rels.ByID(pic.VideoRelID)
+				if !ok || !rel.External() {
+					continue
+				}
+				link.URL = rel.Target
+			} else if pic.HyperlinkRelID != "" {
+				rel, ok := rels.ByID(pic.HyperlinkRelID)
+				if !ok || !rel.External() || videoContentType(rel.Target) == "" {
+					continue
+				}
+				link.URL = rel.Target
+			} else {
+				continue
+			}
+
+			links = append(links, link)
+		}
+	}
+
+	return links, nil
+}
+
+// EmbedVideo stores video inside the package and turns the linked picture into a playable video
+// frame (a:videoFile plus p14:media). contentType is the type the video was downloaded as and names
+// its part; when it is unknown the link's extension is used. When poster is non-nil it is stored as
+// a PNG and replaces the picture's image, otherwise the existing image is kept as the poster frame.
+// The relationships of the old link are removed once nothing on the slide refers to them.
+func (p *Package) EmbedVideo(link VideoLink, video []byte, contentType string, poster []byte) error {
+	data, ok := p.Part(link.SlidePart)
+	if !ok {
+		return fmt.Errorf("missing slide part %s", link.SlidePart)
+	}
+
+	prefixes, err := picturePrefixes(data)
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %w", link.SlidePart, err)
+	}
+
+	slide, err := parseSlide(data)
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %w", link.SlidePart, err)
+	}
+	if link.Picture < 0 || link.Picture >= len(slide.Pictures) {
+		return fmt.Errorf("picture %d not found in %s", link.Picture, link.SlidePart)
+	}
+	pic := slide.Pictures[link.Picture]
+
+	rels, err := p.Rels(link.SlidePart)
+	if err != nil {
+		return err
+	}
+
+	ct, err := p.ContentTypes()
+	if err != nil {
+		return err
+	}
+
+	contentType, ext := videoPartType(contentType, link.URL)
+
+	videoPart := p.addMedia("media", ext, video)
+	ct.EnsureDefault(ext, contentType)
+
+	videoTarget := RelativeTarget(link.SlidePart, videoPart)
+	videoRelID := rels.Add(RelTypeVideo, videoTarget, "")
+	mediaRelID := rels.Add(RelTypeMedia, videoTarget, "")
+
+	imageRelID := pic.ImageRelID
+	if poster != nil {
+		posterPart := p.addMedia("image", ".png", poster)
+		ct.EnsureDefault("png", "image/png")
+		imageRelID = rels.Add(RelTypeImage, RelativeTarget(link.SlidePart, posterPart), "")
+	}
+
+	spPr := fmt.Sprintf("<%s:spPr/>", prefixes.p)
+	if pic.spPrEnd > pic.spPrStart {
+		spPr = string(data[pic.spPrStart:pic.spPrEnd])
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:pic.start])
+	writeVideoPicture(&out, prefixes, pic, videoRelID, mediaRelID, imageRelID, spPr)
+	out.Write(data[pic.end:])
+
+	p.SetPart(link.SlidePart, out.Bytes())
+
+	for _, id := range []string{pic.VideoRelID, pic.HyperlinkRelID} {
+		if id == "" {
+			continue
+		}
+		referenced, err := referencesRel(out.Bytes(), id)
+		if err != nil {
+			return fmt.Errorf("could not parse %s: %w", link.SlidePart, err)
+		}
+		if !referenced {
+			rels.Remove(id)
+		}
+	}
+
+	if err := p.SetRels(link.SlidePart, rels); err != nil {
+		return err
+	}
+
+	return p.SetContentTypes(ct)
+}
+
+// pictureNamespaces are the prefixes a rewritten picture is written with, and the namespace
+// declarations it needs for those the slide does not bind.
+type pictureNamespaces struct {
+	p, a, r string
+	decls   string
+}
+
+func writeVideoPicture(out *bytes.Buffer, ns pictureNamespaces, pic Picture, videoRelID, mediaRelID, imageRelID, spPr string) {
+	p, a, r := ns.p, ns.a, ns.r
+	fmt.Fprintf(out, `<%s:pic%s><%s:nvPicPr><%s:cNvPr id="`, p, ns.decls, p, p)
+	xml.EscapeText(out, []byte(pic.ID))
+	out.WriteString(`" name="`)
+	xml.EscapeText(out, []byte(pic.Name))
+	fmt.Fprintf(out, `"><%s:hlinkClick %s:id="" action="ppaction://media"/></%s:cNvPr>`, a, r, p)
+	fmt.Fprintf(out, `<%s:cNvPicPr><%s:picLocks noChangeAspect="1"/></%s:cNvPicPr>`, p, a, p)
+	fmt.Fprintf(out, `<%s:nvPr><%s:videoFile %s:link="%s"/>`, p, a, r, videoRelID)
+	fmt.Fprintf(out, `<%s:extLst><%s:ext uri="{DAA4B4D4-6D71-4841-9C94-3DE7FCFB9230}">`, p, p)
+	fmt.Fprintf(out, `<p14:media xmlns:p14="%s" %s:embed="%s"/>`, nsPowerPoint14, r, mediaRelID)
+	fmt.Fprintf(out, `</%s:ext></%s:extLst></%s:nvPr></%s:nvPicPr>`, p, p, p, p)
+	fmt.Fprintf(out, `<%s:blipFill>`, p)
+	if imageRelID != "" {
+		fmt.Fprintf(out, `<%s:blip %s:embed="%s"/>`, a, r, imageRelID)
+	}
+	fmt.Fprintf(out, `<%s:stretch><%s:fillRect/></%s:stretch></%s:blipFill>`, a, a, a, p)
+	out.WriteString(spPr)
+	fmt.Fprintf(out, `</%s:pic>`, p)
+}
+
+// picturePrefixes looks up the prefixes the slide's shape tree binds to the p, a and r
+// namespaces, whatever they are called. A namespace without a prefix gets its conventional one
+// declared on the picture, renamed if the slide uses that name for something else.
+func picturePrefixes(data []byte) (pictureNamespaces, error) {
+	root, err := parseXMLTree(data)
+	if err != nil {
+		return pictureNamespaces{}, err
+	}
+	scope := root.Descendant(nsPresentation, "spTree")
+	if scope == nil {
+		return pictureNamespaces{}, fmt.Errorf("slide has no shape tree")
+	}
+
+	var ns pictureNamespaces
+	resolve := func(space, conventional string) string {
+		// attributes need a prefix, so a default namespace binding does not count
+		if prefix, ok := scope.lookupPrefix(space); ok && prefix != "" {
+			return prefix
+		}
+		prefix := conventional
+		for i := 1; scope.lookupNamespace(prefix) != ""; i++ {
+			prefix = fmt.Sprintf("%s%d", conventional, i)
+		}
+		ns.decls += fmt.Sprintf(` xmlns:%s="%s"`, prefix, space)
+		return prefix
+	}
+
+	ns.p = resolve(nsPresentation, "p")
+	ns.a = resolve(nsDrawing, "a")
+	ns.r = resolve(nsOfficeRels, "r")
+	return ns, nil
+}
+
+// addMedia stores data as a new ppt/media part, or returns the part that already holds the same
+// bytes, so a video linked from several pictures is embedded once.
+func (p *Package) addMedia(base, ext string, data []byte) string {
+	sum := sha256.Sum256(data)
+	if name, ok := p.media[sum]; ok {
+		return name
+	}
+
+	name := p.nextMediaPart(base, ext)
+	p.SetPart(name, data)
+	if p.media == nil {
+		p.media = make(map[[sha256.Size]byte]string)
+	}
+	p.media[sum] = name
+	return name
+}
+
+// nextMediaPart returns the first free ppt/media/<base>N<ext> part name.
+func (p *Package) nextMediaPart(base, ext string) string {
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("ppt/media/%s%d%s", base, i, ext)
+		if _, ok := p.Part(name); !ok {
+			return name
+		}
+	}
+}
+
+// videoPartType returns the content type and part extension of a video downloaded as contentType
+// from rawURL, falling back to the URL's extension and then to MP4.
+func videoPartType(contentType, rawURL string) (string, string) {
+	contentType = strings.ToLower(contentType)
+	if ext, ok := videoTypeExtensions[contentType]; ok {
+		return contentType, ext
+	}
+	if strings.HasPrefix(contentType, "video/") {
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			return contentType, exts[0]
+		}
+	}
+
+	ext := strings.ToLower(path.Ext(urlPath(rawURL)))
+	if urlType, ok := videoExtensions[ext]; ok {
+		return urlType, ext
+	}
+
+	return "video/mp4", ".mp4"
+}
+
+// referencesRel reports whether any relationship attribute of a part refers to id.
+func referencesRel(data []byte, id string) (bool, error) {
+	root, err := parseXMLTree(data)
+	if err != nil {
+		return false, err
+	}
+
+	var walk func(n *xmlNode) bool
+	walk = func(n *xmlNode) bool {
+		for _, a := range n.Attrs {
+			if a.Space == nsOfficeRels && a.Value == id {
+				return true
+			}
+		}
+		for _, c := range n.Children {
+			if walk(c) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return walk(root), nil
+}
+
+func videoContentType(rawURL string) string {
+	return videoExtensions[strings.ToLower(path.Ext(urlPath(rawURL)))]
+}
+
+func urlPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Path
+}
@@ -0,0 +1,168 @@
+package pptx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var (
+	testClip   = []byte("\x00\x00\x00\x18ftypmp42clip")
+	testStream = []byte("\x00\x00\x00\x14ftypqt  stream")
+	testWebM   = []byte("\x1a\x45\xdf\xa3webm")
+	testPoster = []byte("\x89PNG\r\n\x1a\nnew poster")
+)
+
+func TestVideoLinks(t *testing.T) {
+	links, err := openDeck(t, "videos").VideoLinks()
+	if err != nil {
+		t.Fatalf("VideoLinks: %v", err)
+	}
+
+	want := []VideoLink{
+		{SlidePart: "ppt/slides/slide1.xml", Picture: 0, Name: "Clip A", URL: "https://cdn.example.com/clip.mp4"},
+		{SlidePart: "ppt/slides/slide1.xml", Picture: 1, Name: "Clip B", URL: "https://cdn.example.com/stream"},
+		{SlidePart: "ppt/slides/slide1.xml", Picture: 2, Name: "Clip A again", URL: "https://cdn.example.com/clip.mp4"},
+		{SlidePart: "ppt/slides/slide3.xml", Picture: 0, Name: "Clip C", URL: "https://cdn.example.com/other.webm"},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("VideoLinks = %+v", links)
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Errorf("link %d = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+}
+
+func TestEmbedVideo(t *testing.T) {
+	p := openDeck(t, "videos")
+	links, err := p.VideoLinks()
+	if err != nil {
+		t.Fatalf("VideoLinks: %v", err)
+	}
+
+	videos := map[string]struct {
+		data        []byte
+		contentType string
+	}{
+		"https://cdn.example.com/clip.mp4":   {testClip, "video/mp4"},
+		"https://cdn.example.com/stream":     {testStream, "video/quicktime"},
+		"https://cdn.example.com/other.webm": {testWebM, ""},
+	}
+	for i, link := range links {
+		var poster []byte
+		if i == 1 {
+			poster = testPoster
+		}
+		v := videos[link.URL]
+		if err := p.EmbedVideo(link, v.data, v.contentType, poster); err != nil {
+			t.Fatalf("EmbedVideo(%s): %v", link.Name, err)
+		}
+	}
+
+	out := reopen(t, p)
+
+	if links, err := out.VideoLinks(); err != nil || len(links) != 0 {
+		t.Errorf("VideoLinks after embedding = %+v, %v", links, err)
+	}
+
+	// the clip linked twice is stored once; the stream without an extension is named by its type
+	media := map[string][]byte{
+		"ppt/media/media2.mp4":  testClip,
+		"ppt/media/media1.mov":  testStream,
+		"ppt/media/image2.png":  testPoster,
+		"ppt/media/media1.webm": testWebM,
+	}
+	for part, data := range media {
+		if got := mustPart(t, out, part); !bytes.Equal(got, data) {
+			t.Errorf("%s = %q, want %q", part, got, data)
+		}
+	}
+	if parts := out.PartNames("ppt/media/"); len(parts) != 7 {
+		t.Errorf("media parts = %v", parts)
+	}
+
+	ct := mustContentTypes(t, out)
+	for part, want := range map[string]string{
+		"ppt/media/media1.mov":  "video/quicktime",
+		"ppt/media/media1.webm": "video/webm",
+		"ppt/media/image2.png":  "image/png",
+	} {
+		if got := ct.Lookup(part); got != want {
+			t.Errorf("content type of %s = %s, want %s", part, got, want)
+		}
+	}
+
+	slides, err := out.Slides()
+	if err != nil {
+		t.Fatalf("Slides: %v", err)
+	}
+
+	rels := mustRels(t, out, "ppt/slides/slide1.xml")
+	wantTargets := []string{"../media/media2.mp4", "../media/media1.mov", "../media/media2.mp4"}
+	for i, pic := range slides[0].Pictures {
+		video, ok := rels.ByID(pic.VideoRelID)
+		if !ok || video.Type != RelTypeVideo || video.External() || video.Target != wantTargets[i] {
+			t.Errorf("%s: video relationship %+v", pic.Name, video)
+		}
+		media, ok := rels.ByID(pic.MediaRelID)
+		if !ok || media.Type != RelTypeMedia || media.Target != wantTargets[i] {
+			t.Errorf("%s: media relationship %+v", pic.Name, media)
+		}
+		if pic.HyperlinkRelID != "" {
+			t.Errorf("%s still links %s", pic.Name, pic.HyperlinkRelID)
+		}
+	}
+
+	// the poster replaces the image of Clip B only
+	if image, _ := rels.ByID(slides[0].Pictures[1].ImageRelID); image.Target != "../media/image2.png" {
+		t.Errorf("poster relationship = %+v", image)
+	}
+	if image, _ := rels.ByID(slides[0].Pictures[0].ImageRelID); image.Target != "../media/image1.png" {
+		t.Errorf("image relationship of Clip A = %+v", image)
+	}
+
+	// the replaced links are gone, the notes are kept
+	for _, rel := range rels.Relationships {
+		if rel.External() {
+			t.Errorf("link relationship %+v left behind", rel)
+		}
+	}
+	if _, ok := rels.ByID("rId5"); !ok {
+		t.Errorf("notes relationship removed")
+	}
+
+	// the new picture uses the slide's own prefixes and declares the one it lacks
+	slide3 := string(mustPart(t, out, "ppt/slides/slide3.xml"))
+	for _, want := range []string{`<pml:pic xmlns:r="` + nsOfficeRels + `">`, `<d:videoFile r:link="`, `<pml:spPr/>`} {
+		if !strings.Contains(slide3, want) {
+			t.Errorf("slide3 lacks %s:\n%s", want, slide3)
+		}
+	}
+	if video := slides[2].Pictures[0]; video.VideoRelID == "" || video.MediaRelID == "" {
+		t.Errorf("slide3 picture = %+v", video)
+	}
+	if rels := mustRels(t, out, "ppt/slides/slide3.xml"); len(rels.Relationships) != 2 {
+		t.Errorf("slide3 relationships = %+v", rels.Relationships)
+	}
+}
+
+func TestVideoPartType(t *testing.T) {
+	tests := []struct {
+		contentType, url  string
+		wantType, wantExt string
+	}{
+		{"video/mp4", "https://cdn.example.com/a", "video/mp4", ".mp4"},
+		{"video/quicktime", "https://cdn.example.com/a.mp4", "video/quicktime", ".mov"},
+		{"application/octet-stream", "https://cdn.example.com/a.webm?x=1", "video/webm", ".webm"},
+		{"", "https://cdn.example.com/a", "video/mp4", ".mp4"},
+	}
+
+	for _, tt := range tests {
+		gotType, gotExt := videoPartType(tt.contentType, tt.url)
+		if gotType != tt.wantType || gotExt != tt.wantExt {
+			t.Errorf("videoPartType(%q, %q) = %s, %s, want %s, %s", tt.contentType, tt.url, gotType, gotExt, tt.wantType, tt.wantExt)
+		}
+	}
+}
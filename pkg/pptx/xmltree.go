@@ -0,0 +1,311 @@
+package pptx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlNode is a minimal XML tree that, unlike encoding/xml marshalling, keeps the original namespace
+// prefixes and declarations so parts can be edited and written back without PowerPoint rejecting them.
+type xmlNode struct {
+	Prefix string
+	Local  string
+	Space  string
+	Attrs  []xmlAttr
+
+	Children []*xmlNode
+	Parent   *xmlNode
+
+	IsText bool
+	Text   string
+
+	// Raw holds processing instructions, comments and directives verbatim
+	Raw []byte
+}
+
+type xmlAttr struct {
+	Prefix string
+	Local  string
+	Space  string
+	Value  string
+}
+
+// parseXMLTree parses a part into a document node whose children are the top-level tokens.
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	doc := &xmlNode{}
+	cur := doc
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Prefix: t.Name.Space, Local: t.Name.Local, Parent: cur}
+			for _, a := range t.Attr {
+				n.Attrs = append(n.Attrs, xmlAttr{Prefix: a.Name.Space, Local: a.Name.Local, Value: a.Value})
+			}
+			cur.Children = append(cur.Children, n)
+			cur = n
+
+			n.Space = n.lookupNamespace(n.Prefix)
+			for i, a := range n.Attrs {
+				if a.Prefix != "" && a.Prefix != "xmlns" {
+					n.Attrs[i].Space = n.lookupNamespace(a.Prefix)
+				}
+			}
+		case xml.EndElement:
+			if cur.Parent == nil {
+				return nil, fmt.Errorf("unexpected closing tag %s", t.Name.Local)
+			}
+			cur = cur.Parent
+		case xml.CharData:
+			cur.Children = append(cur.Children, &xmlNode{IsText: true, Text: string(t), Parent: cur})
+		case xml.ProcInst:
+			cur.Children = append(cur.Children, &xmlNode{Raw: []byte(fmt.Sprintf("<?%s %s?>", t.Target, t.Inst)), Parent: cur})
+		case xml.Comment:
+			cur.Children = append(cur.Children, &xmlNode{Raw: []byte("<!--" + string(t) + "-->"), Parent: cur})
+		case xml.Directive:
+			cur.Children = append(cur.Children, &xmlNode{Raw: []byte("<!" + string(t) + ">"), Parent: cur})
+		}
+	}
+
+	return doc, nil
+}
+
+// Bytes serializes the node and its descendants.
+func (n *xmlNode) Bytes() []byte {
+	var buf bytes.Buffer
+	n.write(&buf)
+	return buf.Bytes()
+}
+
+func (n *xmlNode) write(buf *bytes.Buffer) {
+	switch {
+	case n.Raw != nil:
+		buf.Write(n.Raw)
+		return
+	case n.IsText:
+		buf.WriteString(escapeXML(n.Text, false))
+		return
+	case n.Local == "":
+		for _, c := range n.Children {
+			c.write(buf)
+		}
+		return
+	}
+
+	buf.WriteString("<" + qualified(n.Prefix, n.Local))
+	for _, a := range n.Attrs {
+		buf.WriteString(" " + qualified(a.Prefix, a.Local) + `="` + escapeXML(a.Value, true) + `"`)
+	}
+
+	if len(n.Children) == 0 {
+		buf.WriteString("/>")
+		return
+	}
+
+	buf.WriteString(">")
+	for _, c := range n.Children {
+		c.write(buf)
+	}
+	buf.WriteString("</" + qualified(n.Prefix, n.Local) + ">")
+}
+
+// lookupNamespace resolves a prefix using the xmlns declarations of the node and its ancestors.
+func (n *xmlNode) lookupNamespace(prefix string) string {
+	for cur := n; cur != nil; cur = cur.Parent {
+		for _, a := range cur.Attrs {
+			if (prefix == "" && a.Prefix == "" && a.Local == "xmlns") || (a.Prefix == "xmlns" && a.Local == prefix) {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+// lookupPrefix is the inverse of lookupNamespace.
+func (n *xmlNode) lookupPrefix(space string) (string, bool) {
+	for cur := n; cur != nil; cur = cur.Parent {
+		for _, a := range cur.Attrs {
+			if a.Value != space {
+				continue
+			}
+			if a.Prefix == "xmlns" {
+				return a.Local, true
+			}
+			if a.Prefix == "" && a.Local == "xmlns" {
+				return "", true
+			}
+		}
+	}
+	return "", false
+}
+
+// Is reports whether the node is the element space:local.
+func (n *xmlNode) Is(space, local string) bool {
+	return !n.IsText && n.Raw == nil && n.Space == space && n.Local == local
+}
+
+// Elements returns the direct child elements named space:local.
+func (n *xmlNode) Elements(space, local string) []*xmlNode {
+	var out []*xmlNode
+	for _, c := range n.Children {
+		if c.Is(space, local) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Element returns the first direct child element named space:local.
+func (n *xmlNode) Element(space, local string) *xmlNode {
+	for _, c := range n.Children {
+		if c.Is(space, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Descendants returns every element named space:local below the node, in document order.
+func (n *xmlNode) Descendants(space, local string) []*xmlNode {
+	var out []*xmlNode
+	for _, c := range n.Children {
+		if c.Is(space, local) {
+			out = append(out, c)
+		}
+		out = append(out, c.Descendants(space, local)...)
+	}
+	return out
+}
+
+// Descendant returns the first element named space:local below the node.
+func (n *xmlNode) Descendant(space, local string) *xmlNode {
+	for _, c := range n.Children {
+		if c.Is(space, local) {
+			return c
+		}
+		if d := c.Descendant(space, local); d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// Attr returns the value of the attribute space:local.
+func (n *xmlNode) Attr(space, local string) string {
+	for _, a := range n.Attrs {
+		if a.Space == space && a.Local == local && a.Prefix != "xmlns" {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// SetAttr sets the attribute space:local, adding it if missing.
+func (n *xmlNode) SetAttr(space, local, value string) {
+	for i, a := range n.Attrs {
+		if a.Space == space && a.Local == local && a.Prefix != "xmlns" {
+			n.Attrs[i].Value = value
+			return
+		}
+	}
+
+	prefix := ""
+	if space != "" {
+		prefix, _ = n.lookupPrefix(space)
+	}
+	n.Attrs = append(n.Attrs, xmlAttr{Prefix: prefix, Local: local, Space: space, Value: value})
+}
+
+// NewElement creates a detached element in the given namespace, reusing the prefix the node's
+// document binds to it.
+func (n *xmlNode) NewElement(space, local string) *xmlNode {
+	prefix, _ := n.lookupPrefix(space)
+	return &xmlNode{Prefix: prefix, Local: local, Space: space, Parent: n}
+}
+
+// AppendChild attaches c as the last child of the node.
+func (n *xmlNode) AppendChild(c *xmlNode) *xmlNode {
+	c.Parent = n
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// RemoveChildren detaches every direct child element named space:local.
+func (n *xmlNode) RemoveChildren(space, local string) {
+	kept := n.Children[:0]
+	for _, c := range n.Children {
+		if !c.Is(space, local) {
+			kept = append(kept, c)
+		}
+	}
+	n.Children = kept
+}
+
+// SetText replaces the node's children with a single text node.
+func (n *xmlNode) SetText(text string) {
+	n.Children = []*xmlNode{{IsText: true, Text: text, Parent: n}}
+}
+
+// InnerText concatenates every text node below the node.
+func (n *xmlNode) InnerText() string {
+	var sb strings.Builder
+	for _, c := range n.Children {
+		if c.IsText {
+			sb.WriteString(c.Text)
+		} else {
+			sb.WriteString(c.InnerText())
+		}
+	}
+	return sb.String()
+}
+
+// Clone deep-copies the node; the copy keeps the original parent so prefixes still resolve.
+func (n *xmlNode) Clone() *xmlNode {
+	c := &xmlNode{
+		Prefix: n.Prefix,
+		Local:  n.Local,
+		Space:  n.Space,
+		Attrs:  append([]xmlAttr(nil), n.Attrs...),
+		Parent: n.Parent,
+		IsText: n.IsText,
+		Text:   n.Text,
+		Raw:    n.Raw,
+	}
+	for _, child := range n.Children {
+		cc := child.Clone()
+		cc.Parent = c
+		c.Children = append(c.Children, cc)
+	}
+	return c
+}
+
+func qualified(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\n", "&#xA;", "\t", "&#x9;")
+)
+
+func escapeXML(s string, attr bool) string {
+	if attr {
+		return attrEscaper.Replace(s)
+	}
+	return textEscaper.Replace(s)
+}
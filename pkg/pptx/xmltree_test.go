@@ -0,0 +1,59 @@
+package pptx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXMLTreeRoundTrip(t *testing.T) {
+	tests := []string{
+		`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" + `<p:sld xmlns:p="` + nsPresentation + `"><!-- kept --><p:cSld name="a &amp; b"/></p:sld>`,
+		`<x:root xmlns:x="urn:x" xmlns:y="urn:y"><y:child y:attr="&quot;quoted&quot;&#xA;&#x9;">1 &lt; 2 &amp; 3 &gt; 0</y:child></x:root>`,
+	}
+
+	for _, input := range tests {
+		root, err := parseXMLTree([]byte(input))
+		if err != nil {
+			t.Fatalf("parseXMLTree: %v", err)
+		}
+		if got := string(root.Bytes()); got != input {
+			t.Errorf("round trip changed the part:\n got %s\nwant %s", got, input)
+		}
+	}
+}
+
+func TestXMLTreeNamespaces(t *testing.T) {
+	root, err := parseXMLTree([]byte(`<d:root xmlns:d="` + nsDrawing + `"><d:p><d:r><d:t>a</d:t></d:r><d:r><d:t>b</d:t></d:r></d:p><other xmlns="` + nsDrawing + `"><t>c</t></other></d:root>`))
+	if err != nil {
+		t.Fatalf("parseXMLTree: %v", err)
+	}
+
+	// elements are matched by namespace, whatever their prefix
+	if ts := root.Descendants(nsDrawing, "t"); len(ts) != 3 {
+		t.Errorf("found %d a:t elements, want 3", len(ts))
+	}
+	para := root.Descendant(nsDrawing, "p")
+	if para.InnerText() != "ab" {
+		t.Errorf("InnerText = %q", para.InnerText())
+	}
+
+	// new elements take the prefix of the namespace in scope
+	para.AppendChild(para.NewElement(nsDrawing, "endParaRPr"))
+	clone := para.Clone()
+	clone.SetAttr("", "lvl", `1"2`)
+	para.RemoveChildren(nsDrawing, "r")
+
+	if got := string(para.Bytes()); got != `<d:p><d:endParaRPr/></d:p>` {
+		t.Errorf("edited paragraph = %s", got)
+	}
+	if got := string(clone.Bytes()); !strings.HasPrefix(got, `<d:p lvl="1&quot;2"><d:r>`) {
+		t.Errorf("clone = %s", got)
+	}
+
+	if prefix, ok := para.lookupPrefix(nsDrawing); !ok || prefix != "d" {
+		t.Errorf("lookupPrefix = %q, %v", prefix, ok)
+	}
+	if _, ok := para.lookupPrefix(nsOfficeRels); ok {
+		t.Errorf("lookupPrefix found an undeclared namespace")
+	}
+}
@@ -0,0 +1,298 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownloadCache keeps downloaded media on disk keyed by URL. Entries younger than the TTL are
+// served without a request, older ones are revalidated with their ETag or Last-Modified date.
+// The least recently used entries are removed when the cache grows over its size cap, and
+// entries that have not been used for a whole TTL are removed by Purge.
+type DownloadCache struct {
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+	entries  map[string]downloadEntry
+	mu       sync.Mutex
+}
+
+// downloadEntry is the metadata stored next to a body, the index is rebuilt from it on startup.
+type downloadEntry struct {
+	URL          string    `json:"url"`
+	ContentType  string    `json:"content_type"`
+	SniffedType  string    `json:"sniffed_type"`
+	FinalURL     string    `json:"final_url"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"`
+	Size         int64     `json:"size"`
+	ValidatedAt  time.Time `json:"validated_at"`
+	lastAccess   time.Time
+}
+
+// NewDownloadCache creates the cache directory if needed and indexes the entries already in it.
+func NewDownloadCache(dir string, maxBytes int64, ttl time.Duration) (*DownloadCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create download cache directory: %w", err)
+	}
+
+	c := &DownloadCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		entries:  make(map[string]downloadEntry),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read download cache directory: %w", err)
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), ".json")
+
+		data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			continue
+		}
+		var entry downloadEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+
+		// the body is touched on every hit, so its modification time is the last access
+		info, err := os.Stat(filepath.Join(dir, name+".bin"))
+		if err != nil {
+			continue
+		}
+		entry.lastAccess = info.ModTime()
+		c.entries[name] = entry
+	}
+
+	log.Printf("Download cache indexed %d files from %s", len(c.entries), dir)
+	return c, nil
+}
+
+// Get returns the cached media of a URL and whether it can be used without revalidation.
+func (c *DownloadCache) Get(rawURL string) (*Media, bool) {
+	name := downloadName(rawURL)
+
+	c.mu.Lock()
+	entry, exists := c.entries[name]
+	c.mu.Unlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	body, err := os.ReadFile(c.path(name, ".bin"))
+	if err != nil {
+		c.remove(name)
+		return nil, false
+	}
+
+	c.touch(name)
+
+	return &Media{
+		Body:         body,
+		ContentType:  entry.ContentType,
+		SniffedType:  entry.SniffedType,
+		Length:       int64(len(body)),
+		FinalURL:     entry.FinalURL,
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+	}, time.Since(entry.ValidatedAt) < c.ttl
+}
+
+// Set stores the media of a URL, evicting the least recently used entries when over the cap.
+func (c *DownloadCache) Set(rawURL string, media *Media) error {
+	if media.Length > c.maxBytes {
+		return nil
+	}
+
+	name := downloadName(rawURL)
+	entry := downloadEntry{
+		URL:          rawURL,
+		ContentType:  media.ContentType,
+		SniffedType:  media.SniffedType,
+		FinalURL:     media.FinalURL,
+		ETag:         media.ETag,
+		LastModified: media.LastModified,
+		Size:         media.Length,
+		ValidatedAt:  time.Now(),
+		lastAccess:   time.Now(),
+	}
+
+	// both files are renamed into place so concurrent readers never see a partial body
+	if err := WriteFileAtomic(c.path(name, ".bin"), media.Body); err != nil {
+		return fmt.Errorf("could not cache %s: %w", rawURL, err)
+	}
+	if err := c.writeEntry(name, entry); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.entries[name] = entry
+	c.mu.Unlock()
+
+	return c.evict()
+}
+
+// Revalidated marks the entry of a URL as confirmed by the origin, restarting its TTL.
+func (c *DownloadCache) Revalidated(rawURL string) error {
+	name := downloadName(rawURL)
+
+	c.mu.Lock()
+	entry, exists := c.entries[name]
+	if exists {
+		entry.ValidatedAt = time.Now()
+		c.entries[name] = entry
+	}
+	c.mu.Unlock()
+
+	if !exists {
+		return nil
+	}
+	return c.writeEntry(name, entry)
+}
+
+// Purge removes the entries that have expired and have not been requested since, so URLs that
+// are no longer used do not stay on disk until the size cap evicts them.
+func (c *DownloadCache) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, entry := range c.entries {
+		if time.Since(entry.ValidatedAt) < c.ttl || time.Since(entry.lastAccess) < c.ttl {
+			continue
+		}
+		delete(c.entries, name)
+		if err := c.removeFiles(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *DownloadCache) evict() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var total int64
+	names := make([]string, 0, len(c.entries))
+	for name, entry := range c.entries {
+		total += entry.Size
+		names = append(names, name)
+	}
+
+	if total <= c.maxBytes {
+		return nil
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return c.entries[names[i]].lastAccess.Before(c.entries[names[j]].lastAccess)
+	})
+
+	for _, name := range names {
+		if total <= c.maxBytes {
+			break
+		}
+		total -= c.entries[name].Size
+		delete(c.entries, name)
+		if err := c.removeFiles(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *DownloadCache) touch(name string) {
+	now := time.Now()
+
+	c.mu.Lock()
+	if entry, ok := c.entries[name]; ok {
+		entry.lastAccess = now
+		c.entries[name] = entry
+	}
+	c.mu.Unlock()
+
+	if err := os.Chtimes(c.path(name, ".bin"), now, now); err != nil {
+		log.Printf("Failed to update download cache access time: %v", err)
+	}
+}
+
+func (c *DownloadCache) remove(name string) {
+	c.mu.Lock()
+	delete(c.entries, name)
+	c.mu.Unlock()
+
+	if err := c.removeFiles(name); err != nil {
+		log.Printf("Failed to remove download cache entry: %v", err)
+	}
+}
+
+func (c *DownloadCache) removeFiles(name string) error {
+	for _, ext := range []string{".json", ".bin"} {
+		if err := os.Remove(c.path(name, ext)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DownloadCache) writeEntry(name string, entry downloadEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(c.path(name, ".json"), data); err != nil {
+		return fmt.Errorf("could not cache %s: %w", entry.URL, err)
+	}
+	return nil
+}
+
+func (c *DownloadCache) path(name, ext string) string {
+	return filepath.Join(c.dir, name+ext)
+}
+
+// downloadName hashes the URL, which can be longer than a file name and contain any character.
+func downloadName(rawURL string) string {
+	hash := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(hash[:16])
+}
+
+// WriteFileAtomic renames a complete file into place, so readers never see a partial one.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp creates the file readable by the owner only
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
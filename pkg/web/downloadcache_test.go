@@ -0,0 +1,225 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testLastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+func newTestDownloadCache(t *testing.T, maxBytes int64, ttl time.Duration) *DownloadCache {
+	t.Helper()
+	c, err := NewDownloadCache(t.TempDir(), maxBytes, ttl)
+	if err != nil {
+		t.Fatalf("NewDownloadCache: %v", err)
+	}
+	return c
+}
+
+// validatingServer answers conditional requests with 304 and records the headers it got.
+func validatingServer(t *testing.T, body string, calls *atomic.Int64, conditional *atomic.Value) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		conditional.Store(r.Header.Get("If-None-Match") + "|" + r.Header.Get("If-Modified-Since"))
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", testLastModified)
+		if r.Header.Get("If-None-Match") == `"v1"` || r.Header.Get("If-Modified-Since") == testLastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDownloadCacheServesFreshEntries(t *testing.T) {
+	var calls atomic.Int64
+	var conditional atomic.Value
+	srv := validatingServer(t, "hello", &calls, &conditional)
+
+	cache := newTestDownloadCache(t, 1<<20, time.Hour)
+	f := newTestFetcher(t, FetchOptions{Allow: []string{"127.0.0.0/8"}, Cache: cache})
+
+	for i := 0; i < 3; i++ {
+		media, err := f.Fetch(srv.URL)
+		if err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		if string(media.Body) != "hello" || media.ContentType != "text/plain" {
+			t.Errorf("got %q as %s", media.Body, media.ContentType)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("server called %d times, want 1", n)
+	}
+}
+
+func TestDownloadCacheRevalidatesExpiredEntries(t *testing.T) {
+	var calls atomic.Int64
+	var conditional atomic.Value
+	srv := validatingServer(t, "hello", &calls, &conditional)
+
+	// a TTL of zero revalidates on every request
+	cache := newTestDownloadCache(t, 1<<20, 0)
+	f := newTestFetcher(t, FetchOptions{Allow: []string{"127.0.0.0/8"}, Cache: cache})
+
+	if _, err := f.Fetch(srv.URL); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if got := conditional.Load(); got != "|" {
+		t.Errorf("first request sent conditional headers %q", got)
+	}
+
+	media, err := f.Fetch(srv.URL)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if got := conditional.Load(); got != `"v1"|`+testLastModified {
+		t.Errorf("conditional headers = %q", got)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("server called %d times, want 2", n)
+	}
+
+	// the 304 reuses the cached body and restarts the TTL of the entry
+	if string(media.Body) != "hello" || media.ContentType != "text/plain" || media.ETag != `"v1"` {
+		t.Errorf("revalidated media = %q as %s, etag %s", media.Body, media.ContentType, media.ETag)
+	}
+	entry := cache.entries[downloadName(srv.URL)]
+	if time.Since(entry.ValidatedAt) > time.Minute {
+		t.Errorf("ValidatedAt = %v, not restarted", entry.ValidatedAt)
+	}
+}
+
+func TestDownloadCacheReplacesChangedEntries(t *testing.T) {
+	var version atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"v` + strconv.FormatInt(version.Load(), 10) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("body " + etag))
+	}))
+	defer srv.Close()
+
+	cache := newTestDownloadCache(t, 1<<20, 0)
+	f := newTestFetcher(t, FetchOptions{Allow: []string{"127.0.0.0/8"}, Cache: cache})
+
+	if _, err := f.Fetch(srv.URL); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	version.Add(1)
+
+	media, err := f.Fetch(srv.URL)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(media.Body) != `body "v1"` {
+		t.Errorf("Body = %q, want the changed body", media.Body)
+	}
+	if cached, _ := cache.Get(srv.URL); cached == nil || string(cached.Body) != `body "v1"` {
+		t.Errorf("cache kept the old body")
+	}
+}
+
+func TestDownloadCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newTestDownloadCache(t, 25, time.Hour)
+	set := func(u string) {
+		t.Helper()
+		body := []byte(strings.Repeat("x", 10))
+		if err := cache.Set(u, &Media{Body: body, Length: int64(len(body))}); err != nil {
+			t.Fatalf("Set(%s): %v", u, err)
+		}
+	}
+
+	set("https://example.com/a")
+	set("https://example.com/b")
+	// reading a makes b the least recently used
+	time.Sleep(10 * time.Millisecond)
+	if media, _ := cache.Get("https://example.com/a"); media == nil {
+		t.Fatalf("a is missing")
+	}
+	set("https://example.com/c")
+
+	for u, want := range map[string]bool{"https://example.com/a": true, "https://example.com/b": false, "https://example.com/c": true} {
+		if media, _ := cache.Get(u); (media != nil) != want {
+			t.Errorf("Get(%s) cached = %v, want %v", u, media != nil, want)
+		}
+	}
+	if _, err := os.Stat(cache.path(downloadName("https://example.com/b"), ".bin")); !os.IsNotExist(err) {
+		t.Errorf("evicted body left on disk: %v", err)
+	}
+
+	// a body over the cap is never stored
+	big := []byte(strings.Repeat("x", 30))
+	if err := cache.Set("https://example.com/big", &Media{Body: big, Length: int64(len(big))}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if media, _ := cache.Get("https://example.com/big"); media != nil {
+		t.Errorf("body over the cap was cached")
+	}
+}
+
+func TestDownloadCachePurge(t *testing.T) {
+	cache := newTestDownloadCache(t, 1<<20, time.Hour)
+	for _, u := range []string{"https://example.com/unused", "https://example.com/used", "https://example.com/fresh"} {
+		if err := cache.Set(u, &Media{Body: []byte("body"), Length: 4}); err != nil {
+			t.Fatalf("Set(%s): %v", u, err)
+		}
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	backdate := func(u string, validated, accessed time.Time) {
+		name := downloadName(u)
+		entry := cache.entries[name]
+		entry.ValidatedAt, entry.lastAccess = validated, accessed
+		cache.entries[name] = entry
+	}
+	backdate("https://example.com/unused", old, old)
+	// an expired entry still being requested waits for its revalidation
+	backdate("https://example.com/used", old, time.Now())
+
+	if err := cache.Purge(); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+
+	for u, want := range map[string]bool{"https://example.com/unused": false, "https://example.com/used": true, "https://example.com/fresh": true} {
+		if _, ok := cache.entries[downloadName(u)]; ok != want {
+			t.Errorf("%s kept = %v, want %v", u, ok, want)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(cache.dir, downloadName("https://example.com/unused")+".*"))
+	if err != nil || len(files) != 0 {
+		t.Errorf("purged files left on disk: %v, %v", files, err)
+	}
+}
+
+func TestDownloadCacheReindexesOnStartup(t *testing.T) {
+	cache := newTestDownloadCache(t, 1<<20, time.Hour)
+	media := &Media{Body: []byte("body"), Length: 4, ContentType: "text/plain", ETag: `"v1"`}
+	if err := cache.Set("https://example.com/a", media); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	reopened, err := NewDownloadCache(cache.dir, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDownloadCache: %v", err)
+	}
+	got, fresh := reopened.Get("https://example.com/a")
+	if got == nil || !fresh || string(got.Body) != "body" || got.ContentType != "text/plain" || got.ETag != `"v1"` {
+		t.Errorf("Get after restart = %+v, fresh %v", got, fresh)
+	}
+}
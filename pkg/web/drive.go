@@ -0,0 +1,127 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	defaultDriveAPIURL = "https://www.googleapis.com"
+	pptxMimeType       = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+
+	defaultDriveExportTimeout  = 2 * time.Minute
+	defaultDriveExportMaxBytes = 100 << 20
+)
+
+var (
+	// driveClient is kept apart from the media fetcher, the Drive API is a trusted host that
+	// needs an auth token but none of the address checks of user supplied URLs.
+	driveClient = resty.New()
+
+	presentationURLPattern = regexp.MustCompile(`/presentation/d/([A-Za-z0-9_-]+)`)
+	presentationIDPattern  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// DriveError is an error response of the Drive API, like 404 for a presentation that does not
+// exist or is not shared with the token's account.
+type DriveError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *DriveError) Error() string {
+	return fmt.Sprintf("drive API error %d: %s", e.StatusCode, e.Message)
+}
+
+// PresentationID extracts the presentation ID from a Google Slides URL, or returns the input if it already is an ID.
+func PresentationID(idOrURL string) (string, error) {
+	idOrURL = strings.TrimSpace(idOrURL)
+
+	if m := presentationURLPattern.FindStringSubmatch(idOrURL); m != nil {
+		return m[1], nil
+	}
+
+	if presentationIDPattern.MatchString(idOrURL) {
+		return idOrURL, nil
+	}
+
+	return "", fmt.Errorf("invalid Google Slides presentation ID or URL: %s", idOrURL)
+}
+
+// ExportGoogleSlides exports a Google Slides presentation as PPTX through the Drive export API,
+// authenticating with an OAuth access token (e.g. one minted for a service account).
+// GOOGLE_DRIVE_API_URL overrides the API base URL, which allows pointing it at a local stand-in.
+// The export is limited to GOOGLE_DRIVE_EXPORT_TIMEOUT (2m by default) and
+// GOOGLE_DRIVE_EXPORT_MAX_BYTES (100 MiB by default), a larger file fails with ErrTooLarge.
+func ExportGoogleSlides(idOrURL, accessToken string) ([]byte, error) {
+	id, err := PresentationID(idOrURL)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := os.Getenv("GOOGLE_DRIVE_API_URL")
+	if baseURL == "" {
+		baseURL = defaultDriveAPIURL
+	}
+
+	timeout := envDuration("GOOGLE_DRIVE_EXPORT_TIMEOUT")
+	if timeout <= 0 {
+		timeout = defaultDriveExportTimeout
+	}
+	maxBytes := envInt("GOOGLE_DRIVE_EXPORT_MAX_BYTES", defaultDriveExportMaxBytes)
+
+	// the deadline also covers reading the body, which is streamed to enforce the size cap
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resp, err := driveClient.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		SetAuthToken(accessToken).
+		SetPathParam("id", id).
+		SetQueryParam("mimeType", pptxMimeType).
+		Get(strings.TrimSuffix(baseURL, "/") + "/drive/v3/files/{id}/export")
+	if err != nil {
+		return nil, fmt.Errorf("failed to export presentation %s: %w", id, err)
+	}
+
+	raw := resp.RawBody()
+	defer raw.Close()
+
+	if resp.IsError() {
+		// error bodies are short JSON documents, a little is enough for the message
+		body, _ := io.ReadAll(io.LimitReader(raw, 64<<10))
+		return nil, fmt.Errorf("failed to export presentation %s: %w", id, driveError(resp.StatusCode(), body))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(raw, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to export presentation %s: %w", id, err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("failed to export presentation %s: %w: over %d bytes", id, ErrTooLarge, maxBytes)
+	}
+
+	return body, nil
+}
+
+// driveError reads the message of a Google API error body, falling back to the raw body.
+func driveError(status int, body []byte) *DriveError {
+	var parsed struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error.Message != "" {
+		return &DriveError{StatusCode: status, Message: parsed.Error.Message}
+	}
+	return &DriveError{StatusCode: status, Message: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresentationID(t *testing.T) {
+	tests := map[string]string{
+		"1AbC_d-E": "1AbC_d-E",
+		"https://docs.google.com/presentation/d/1AbC_d-E/edit#slide=id.p": "1AbC_d-E",
+	}
+
+	for input, want := range tests {
+		if got, err := PresentationID(input); err != nil || got != want {
+			t.Errorf("PresentationID(%s) = %s, %v, want %s", input, got, err, want)
+		}
+	}
+
+	if _, err := PresentationID("https://example.com/file"); err == nil {
+		t.Error("PresentationID accepted a URL without a presentation ID")
+	}
+}
+
+func TestExportGoogleSlides(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/drive/v3/files/deck-1/export" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("mimeType"); got != pptxMimeType {
+			t.Errorf("mimeType = %s", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer token-1" {
+			t.Errorf("Authorization = %s", got)
+		}
+		w.Write([]byte("pptx"))
+	}))
+	defer srv.Close()
+	t.Setenv("GOOGLE_DRIVE_API_URL", srv.URL+"/")
+
+	deck, err := ExportGoogleSlides("https://docs.google.com/presentation/d/deck-1/edit", "token-1")
+	if err != nil || string(deck) != "pptx" {
+		t.Fatalf("ExportGoogleSlides = %q, %v", deck, err)
+	}
+}
+
+func TestExportGoogleSlidesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"google error", http.StatusNotFound, `{"error":{"code":404,"message":"File not found: deck-1."}}`, "File not found: deck-1."},
+		{"plain body", http.StatusForbidden, "forbidden\n", "forbidden"},
+		{"server error", http.StatusServiceUnavailable, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			t.Setenv("GOOGLE_DRIVE_API_URL", srv.URL)
+
+			_, err := ExportGoogleSlides("deck-1", "token-1")
+			var driveErr *DriveError
+			if !errors.As(err, &driveErr) {
+				t.Fatalf("error = %v, want a DriveError", err)
+			}
+			if driveErr.StatusCode != tt.status || driveErr.Message != tt.message {
+				t.Errorf("DriveError = %+v, want %d %q", driveErr, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestExportGoogleSlidesLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/drive/v3/files/slow/export" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+	t.Setenv("GOOGLE_DRIVE_API_URL", srv.URL)
+	t.Setenv("GOOGLE_DRIVE_EXPORT_TIMEOUT", "50ms")
+
+	t.Setenv("GOOGLE_DRIVE_EXPORT_MAX_BYTES", "100")
+	if deck, err := ExportGoogleSlides("deck-1", "token-1"); err != nil || len(deck) != 100 {
+		t.Errorf("export at the cap = %d bytes, %v", len(deck), err)
+	}
+
+	t.Setenv("GOOGLE_DRIVE_EXPORT_MAX_BYTES", "99")
+	if _, err := ExportGoogleSlides("deck-1", "token-1"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("export over the cap error = %v, want ErrTooLarge", err)
+	}
+
+	if _, err := ExportGoogleSlides("slow", "token-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow export error = %v, want a deadline error", err)
+	}
+}
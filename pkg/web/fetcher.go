@@ -0,0 +1,485 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+var (
+	// ErrTooLarge is returned when a response exceeds FetchOptions.MaxBytes or the size cap of a
+	// Google Slides export.
+	ErrTooLarge = errors.New("response too large")
+	// ErrBlockedAddress is returned when a URL resolves to an address that may not be fetched.
+	ErrBlockedAddress = errors.New("blocked address")
+	// ErrUnexpectedType is returned by Media.Expect when the media is of another type.
+	ErrUnexpectedType = errors.New("unexpected media type")
+	// ErrFetcherConfig is returned by FetchMedia when the environment does not configure a usable fetcher.
+	ErrFetcherConfig = errors.New("invalid media fetcher configuration")
+)
+
+// blockedPrefixes are the ranges besides loopback, private and link-local addresses that never
+// point at public media.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	// 6to4 and Teredo addresses carry an IPv4 address that a relay would connect to
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("2001::/32"),
+}
+
+// FetchOptions configures a Fetcher. Zero values take the defaults of NewFetcher.
+type FetchOptions struct {
+	// ConnectTimeout bounds resolving, connecting and the TLS handshake.
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds the wait for the response headers and between two reads of the body, so
+	// slow but steady downloads of large files are not cut off.
+	ReadTimeout time.Duration
+	// MaxBytes is the largest response body that is read.
+	MaxBytes int64
+	// Retries is how often a request is repeated after a 5xx response or a timeout.
+	Retries int
+	// RetryWait is the wait before the first retry, doubled for every further one.
+	RetryWait time.Duration
+	// MaxRedirects is the number of redirects followed, -1 disables them.
+	MaxRedirects int
+	// Allow lists hosts ("minio.internal", "*.svc.cluster.local") and networks ("10.1.0.0/16")
+	// that may be fetched although they are private.
+	Allow []string
+	// Cache keeps downloads on disk when set.
+	Cache *DownloadCache
+}
+
+// Fetcher downloads media from user supplied URLs. Addresses are checked after DNS resolution on
+// every connection, so neither redirects nor DNS rebinding reach internal services.
+type Fetcher struct {
+	opts     FetchOptions
+	client   *resty.Client
+	hosts    []string
+	networks []netip.Prefix
+}
+
+// NewFetcher creates a Fetcher, an invalid Allow entry is an error.
+func NewFetcher(opts FetchOptions) (*Fetcher, error) {
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = 10 * time.Second
+	}
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = 30 * time.Second
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 512 << 20
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.RetryWait <= 0 {
+		opts.RetryWait = 500 * time.Millisecond
+	}
+	if opts.MaxRedirects == 0 {
+		opts.MaxRedirects = 5
+	}
+
+	f := &Fetcher{opts: opts}
+	for _, entry := range opts.Allow {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if !strings.Contains(entry, "/") {
+			f.hosts = append(f.hosts, entry)
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network %s: %w", entry, err)
+		}
+		f.networks = append(f.networks, prefix.Masked())
+	}
+
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout, Control: f.checkAddress}
+	allowedDialer := &net.Dialer{Timeout: opts.ConnectTimeout}
+
+	transport := &http.Transport{
+		// a proxy would be the only address the check sees
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err == nil && f.allowedHost(host) {
+				return allowedDialer.DialContext(ctx, network, addr)
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.ReadTimeout,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	redirects := opts.MaxRedirects
+	if redirects < 0 {
+		redirects = 0
+	}
+
+	f.client = resty.New().
+		SetTransport(transport).
+		SetDoNotParseResponse(true).
+		SetRedirectPolicy(resty.FlexibleRedirectPolicy(redirects), resty.RedirectPolicyFunc(func(req *http.Request, _ []*http.Request) error {
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("%w: redirect to %s URL", ErrBlockedAddress, req.URL.Scheme)
+			}
+			return nil
+		}))
+
+	return f, nil
+}
+
+// Media is a downloaded response body with what is known about its type.
+type Media struct {
+	Body []byte
+	// ContentType is the declared Content-Type without parameters.
+	ContentType string
+	// SniffedType is the type detected from the first bytes of Body.
+	SniffedType string
+	Length      int64
+	// FinalURL is the URL the body was served from after redirects.
+	FinalURL     string
+	ETag         string
+	LastModified string
+
+	// noStore is set when the origin asked for the response not to be kept.
+	noStore bool
+}
+
+// Fetch downloads a URL, retrying 5xx responses and timeouts with exponential backoff.
+func (f *Fetcher) Fetch(rawURL string) (*Media, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid media URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrBlockedAddress, u.Scheme)
+	}
+
+	cache := f.opts.Cache
+	if cache == nil {
+		return f.download(rawURL, nil)
+	}
+
+	cached, fresh := cache.Get(rawURL)
+	if fresh {
+		return cached, nil
+	}
+
+	media, err := f.download(rawURL, cached)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cache only speeds up later downloads, failing to write it does not fail this one
+	if media == cached {
+		err = cache.Revalidated(rawURL)
+	} else if !media.noStore {
+		err = cache.Set(rawURL, media)
+	}
+	if err != nil {
+		log.Printf("Download cache error: %v", err)
+	}
+
+	return media, nil
+}
+
+// download requests a URL with retries. It returns cached itself when the origin confirms that
+// the cached copy is still current.
+func (f *Fetcher) download(rawURL string, cached *Media) (*Media, error) {
+	wait := f.opts.RetryWait
+	for attempt := 0; ; attempt++ {
+		media, retry, err := f.fetch(rawURL, cached)
+		if err == nil || !retry || attempt >= f.opts.Retries {
+			return media, err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// fetch makes a single attempt and reports whether a failure is worth retrying.
+func (f *Fetcher) fetch(rawURL string, cached *Media) (*Media, bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := f.client.R().SetContext(ctx)
+	if cached != nil && cached.ETag != "" {
+		req.SetHeader("If-None-Match", cached.ETag)
+	}
+	if cached != nil && cached.LastModified != "" {
+		req.SetHeader("If-Modified-Since", cached.LastModified)
+	}
+
+	resp, err := req.Get(rawURL)
+	if err != nil {
+		return nil, isTimeout(err), err
+	}
+
+	raw := resp.RawBody()
+	defer raw.Close()
+
+	if resp.StatusCode() == http.StatusNotModified && cached != nil {
+		return cached, false, nil
+	}
+
+	if resp.IsError() {
+		// a little of the body explains most errors without reading a whole error page
+		snippet, _ := io.ReadAll(io.LimitReader(raw, 512))
+		return nil, resp.StatusCode() >= 500, fmt.Errorf("failed to fetch media: %s, %s", resp.Status(), bytes.TrimSpace(snippet))
+	}
+
+	if resp.RawResponse.ContentLength > f.opts.MaxBytes {
+		return nil, false, fmt.Errorf("%w: %d bytes exceed the limit of %d", ErrTooLarge, resp.RawResponse.ContentLength, f.opts.MaxBytes)
+	}
+
+	// the idle timer cancels the request when the body stalls
+	idle := time.AfterFunc(f.opts.ReadTimeout, cancel)
+	defer idle.Stop()
+
+	body, err := io.ReadAll(&idleReader{r: io.LimitReader(raw, f.opts.MaxBytes+1), idle: idle, timeout: f.opts.ReadTimeout})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, true, fmt.Errorf("timeout reading media after %s without data: %w", f.opts.ReadTimeout, err)
+		}
+		return nil, isTimeout(err), fmt.Errorf("could not read media: %w", err)
+	}
+
+	if int64(len(body)) > f.opts.MaxBytes {
+		return nil, false, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, f.opts.MaxBytes)
+	}
+
+	media := NewMedia(body, resp.Header().Get("Content-Type"))
+	media.FinalURL = resp.RawResponse.Request.URL.String()
+	media.ETag = resp.Header().Get("ETag")
+	media.LastModified = resp.Header().Get("Last-Modified")
+	media.noStore = strings.Contains(strings.ToLower(resp.Header().Get("Cache-Control")), "no-store")
+
+	return media, false, nil
+}
+
+// NewMedia describes a body that did not come from a download, like an upload, so it can be
+// checked with Expect as well.
+func NewMedia(body []byte, contentType string) *Media {
+	media := &Media{
+		Body:        body,
+		SniffedType: sniffType(body),
+		Length:      int64(len(body)),
+	}
+	if declared, _, err := mime.ParseMediaType(contentType); err == nil {
+		media.ContentType = declared
+	}
+	return media
+}
+
+// Expect checks the media against type patterns like "video/*" or "image/png". The sniffed type
+// decides; the declared one is only used when the body is not recognized, and media that neither
+// identifies is accepted so the decoder can have the last word.
+func (m *Media) Expect(patterns ...string) error {
+	actual := m.Type()
+	if actual == "" || actual == genericType {
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(actual, prefix) || actual == pattern {
+			return nil
+		}
+	}
+
+	err := fmt.Errorf("%w: expected %s, got %s (declared %s)",
+		ErrUnexpectedType, strings.Join(patterns, " or "), actual, orUnknown(m.ContentType))
+	if m.FinalURL != "" {
+		err = fmt.Errorf("%w from %s", err, m.FinalURL)
+	}
+	return err
+}
+
+// Type returns the sniffed type of the media, or the declared one when sniffing found nothing specific.
+func (m *Media) Type() string {
+	if m.SniffedType == genericType {
+		return m.ContentType
+	}
+	return m.SniffedType
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// checkAddress runs for every connection with the resolved address, before connecting.
+func (f *Fetcher) checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range f.networks {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+
+	if blockedAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	return nil
+}
+
+func (f *Fetcher) allowedHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range f.hosts {
+		if host == pattern {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func blockedAddr(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() || addr.IsMulticast() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded)
+}
+
+// idleReader pushes the idle timer back whenever data arrives.
+type idleReader struct {
+	r       io.Reader
+	idle    *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.idle.Reset(r.timeout)
+	}
+	return n, err
+}
+
+const defaultDownloadCacheDir = "./media_cache"
+
+var (
+	mediaFetcher     *Fetcher
+	mediaFetcherErr  error
+	mediaFetcherOnce sync.Once
+)
+
+// getMediaFetcher configures the fetcher of FetchMedia from MEDIA_FETCH_CONNECT_TIMEOUT,
+// MEDIA_FETCH_READ_TIMEOUT, MEDIA_FETCH_MAX_BYTES, MEDIA_FETCH_RETRIES, MEDIA_FETCH_MAX_REDIRECTS
+// and MEDIA_FETCH_ALLOW, a comma separated list of hosts and networks. Downloads are cached in
+// MEDIA_CACHE_DIR (./media_cache by default) for MEDIA_CACHE_TTL up to MEDIA_CACHE_MAX_BYTES,
+// a size of 0 disables the cache, as does a cache directory that cannot be used.
+func getMediaFetcher() (*Fetcher, error) {
+	mediaFetcherOnce.Do(func() {
+		var cache *DownloadCache
+		if maxBytes := envInt("MEDIA_CACHE_MAX_BYTES", 2<<30); maxBytes > 0 {
+			dir := os.Getenv("MEDIA_CACHE_DIR")
+			if dir == "" {
+				dir = defaultDownloadCacheDir
+			}
+			ttl, err := time.ParseDuration(os.Getenv("MEDIA_CACHE_TTL"))
+			if err != nil {
+				ttl = time.Hour
+			}
+
+			// downloads still work without the cache, so a broken cache directory only costs speed
+			if cache, err = NewDownloadCache(dir, maxBytes, ttl); err != nil {
+				log.Printf("Download cache disabled: %v", err)
+			} else {
+				// a TTL of zero revalidates every request, which still needs an interval to purge at
+				go purgeDownloadCache(cache, max(ttl, time.Minute))
+			}
+		}
+
+		mediaFetcher, mediaFetcherErr = NewFetcher(FetchOptions{
+			ConnectTimeout: envDuration("MEDIA_FETCH_CONNECT_TIMEOUT"),
+			ReadTimeout:    envDuration("MEDIA_FETCH_READ_TIMEOUT"),
+			MaxBytes:       envInt("MEDIA_FETCH_MAX_BYTES", 0),
+			Retries:        int(envInt("MEDIA_FETCH_RETRIES", 2)),
+			MaxRedirects:   int(envInt("MEDIA_FETCH_MAX_REDIRECTS", 0)),
+			Allow:          envList("MEDIA_FETCH_ALLOW"),
+			Cache:          cache,
+		})
+	})
+	return mediaFetcher, mediaFetcherErr
+}
+
+func purgeDownloadCache(cache *DownloadCache, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		if err := cache.Purge(); err != nil {
+			log.Printf("Failed to purge expired download cache entries: %v", err)
+		}
+	}
+}
+
+func envDuration(key string) time.Duration {
+	d, _ := time.ParseDuration(os.Getenv(key))
+	return d
+}
+
+func envInt(key string, fallback int64) int64 {
+	n, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+func envList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,157 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestFetcher(t *testing.T, opts FetchOptions) *Fetcher {
+	t.Helper()
+	opts.RetryWait = time.Millisecond
+	f, err := NewFetcher(opts)
+	if err != nil {
+		t.Fatalf("NewFetcher: %v", err)
+	}
+	return f
+}
+
+func mediaServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// localhostURL addresses a test server by name instead of by its loopback address.
+func localhostURL(srv *httptest.Server) string {
+	return strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+}
+
+func TestFetchBlocksLoopbackByDefault(t *testing.T) {
+	srv := mediaServer(t, "hello")
+	f := newTestFetcher(t, FetchOptions{})
+
+	for _, u := range []string{srv.URL, localhostURL(srv)} {
+		if _, err := f.Fetch(u); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Fetch(%s) error = %v, want ErrBlockedAddress", u, err)
+		}
+	}
+}
+
+func TestFetchAllowsListedHostsAndNetworks(t *testing.T) {
+	srv := mediaServer(t, "hello")
+
+	tests := []struct {
+		name  string
+		allow []string
+		url   string
+	}{
+		{"host", []string{"localhost"}, localhostURL(srv)},
+		{"network", []string{"127.0.0.0/8"}, srv.URL},
+		{"single address", []string{"127.0.0.1/32"}, srv.URL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFetcher(t, FetchOptions{Allow: tt.allow})
+			media, err := f.Fetch(tt.url)
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			if string(media.Body) != "hello" || media.ContentType != "text/plain" {
+				t.Errorf("got %q as %s", media.Body, media.ContentType)
+			}
+		})
+	}
+}
+
+func TestFetchRejectsRedirectToPrivateAddress(t *testing.T) {
+	target := mediaServer(t, "secret")
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	// only the redirecting host is allowed, the target is reached by its loopback address
+	f := newTestFetcher(t, FetchOptions{Allow: []string{"localhost"}})
+	if _, err := f.Fetch(localhostURL(redirect)); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Fetch error = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestFetchRejectsTooLargeBodies(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	sized := mediaServer(t, body)
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// flushing before the end drops the Content-Length
+		w.Write([]byte(body[:50]))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(body[50:]))
+	}))
+	defer chunked.Close()
+
+	f := newTestFetcher(t, FetchOptions{MaxBytes: 10, Allow: []string{"127.0.0.1/32"}})
+	for _, u := range []string{sized.URL, chunked.URL} {
+		if _, err := f.Fetch(u); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("Fetch(%s) error = %v, want ErrTooLarge", u, err)
+		}
+	}
+}
+
+func TestFetchRetriesServerErrorsOnly(t *testing.T) {
+	tests := []struct {
+		status int
+		calls  int64
+	}{
+		{http.StatusBadGateway, 3},
+		{http.StatusNotFound, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var calls atomic.Int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				http.Error(w, "nope", tt.status)
+			}))
+			defer srv.Close()
+
+			f := newTestFetcher(t, FetchOptions{Retries: 2, Allow: []string{"127.0.0.1/32"}})
+			if _, err := f.Fetch(srv.URL); err == nil {
+				t.Fatal("Fetch succeeded, want an error")
+			}
+			if got := calls.Load(); got != tt.calls {
+				t.Errorf("server called %d times, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestBlockedAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"169.254.169.254": true,
+		"::1":             true,
+		"fd00::1":         true,
+		"2002:7f00:1::":   true,
+		"2001:0:4136::1":  true,
+		"93.184.216.34":   false,
+		"2606:4700::1":    false,
+	}
+
+	for addr, want := range tests {
+		if got := blockedAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("blockedAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
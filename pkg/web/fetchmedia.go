@@ -1,22 +1,13 @@
 package web
 
-import (
-	"fmt"
+import "fmt"
 
-	"github.com/go-resty/resty/v2"
-)
-
-var client = resty.New()
-
-func FetchMedia(mediaURI string) ([]byte, error) {
-	resp, err := client.R().Get(mediaURI)
+// FetchMedia downloads media from a user supplied URL with the limits of the shared fetcher.
+func FetchMedia(mediaURI string) (*Media, error) {
+	fetcher, err := getMediaFetcher()
 	if err != nil {
-		return nil, err
-	}
-
-	if resp.IsError() {
-		return nil, fmt.Errorf("failed to fetch media: %s, %s", resp.Status(), resp.String())
+		return nil, fmt.Errorf("%w: %w", ErrFetcherConfig, err)
 	}
 
-	return resp.Body(), nil
+	return fetcher.Fetch(mediaURI)
 }
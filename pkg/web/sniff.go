@@ -0,0 +1,34 @@
+package web
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+)
+
+const genericType = "application/octet-stream"
+
+// sniffType detects the type of a body. http.DetectContentType only knows mp4 files with an mp4
+// brand, so the other ISO media brands are recognized here.
+func sniffType(body []byte) string {
+	if len(body) >= 12 && bytes.Equal(body[4:8], []byte("ftyp")) {
+		switch string(body[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "M4A ", "M4B ":
+			return "audio/mp4"
+		case "heic", "heix", "mif1":
+			return "image/heic"
+		case "avif":
+			return "image/avif"
+		case "3gp4", "3gp5", "3gp6":
+			return "video/3gpp"
+		}
+	}
+
+	detected, _, err := mime.ParseMediaType(http.DetectContentType(body))
+	if err != nil {
+		return genericType
+	}
+	return detected
+}